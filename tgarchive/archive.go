@@ -6,10 +6,17 @@ import (
 	"errors"
 	"fmt"
 	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgdir"
+	"github.com/kittenbark/tgmedia/tgjournal"
+	"github.com/kittenbark/tgmedia/tgsend"
+	"github.com/kittenbark/tgmedia/tgtemp"
 	"io"
 	"io/fs"
+	"maps"
 	"os"
 	"path"
+	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -21,118 +28,272 @@ func SendBy2GB(ctx context.Context, chatId int64, dir string, filename string, o
 	return SendByN(ctx, chatId, dir, filename, 2_000_000_000, opt...)
 }
 
-func SendByN(ctx context.Context, chatId int64, dir string, filename string, n int64, opt ...*tg.OptSendDocument) (messages []*tg.Message, err error) {
+func SendByN(ctx context.Context, chatId int64, dir string, filename string, n int64, opt ...*tg.OptSendDocument) ([]*tg.Message, error) {
+	archiver := &Archiver{ChunkSize: n}
+	if len(opt) > 0 {
+		archiver.Document = opt[0]
+	}
+	return archiver.Send(ctx, chatId, dir, filename)
+}
+
+// SendFSByN is SendByN for the files of fsys (an embed.FS, a zip.Reader, ...).
+func SendFSByN(ctx context.Context, chatId int64, fsys fs.FS, filename string, n int64, opt ...*tg.OptSendDocument) ([]*tg.Message, error) {
+	archiver := &Archiver{ChunkSize: n}
+	if len(opt) > 0 {
+		archiver.Document = opt[0]
+	}
+	return archiver.SendFS(ctx, chatId, fsys, filename)
+}
+
+// Archiver sends a directory as tar archives, SendByN with options.
+type Archiver struct {
+	// ChunkSize is the most bytes of files an archive takes.
+	ChunkSize int64
+	// Journal records the files of every archive sent, the files it has for the chat are left out. Sending
+	// the same directory again with the same journal resumes where an interrupted run stopped.
+	Journal *tgjournal.Journal
+	// Order is the order of the files of every directory and Subdirs how subdirectories are gone through,
+	// as in tgdir.Sender. With tgdir.SubdirsGrouped, every directory starts an archive of its own.
+	Order   tgdir.Order
+	Subdirs tgdir.Subdirs
+	// Filter picks the files to archive, as in tgdir.Sender.
+	Filter   *tgdir.Filter
+	Document *tg.OptSendDocument
+}
+
+// chunk is an archive being written.
+type chunk struct {
+	file    *os.File
+	writer  *tar.Writer
+	size    int64
+	members []*member
+	// dirs are the directories the archive has headers of.
+	dirs map[string]bool
+}
+
+// member is a file of an archive, path is its path on disk or, if fsys isn't nil, in fsys.
+type member struct {
+	fsys fs.FS
+	path string
+	info fs.FileInfo
+}
+
+// Send sends dir as filename.tar, filename_02.tar, ...
+func (a *Archiver) Send(ctx context.Context, chatId int64, dir string, filename string) ([]*tg.Message, error) {
+	return a.send(ctx, chatId, os.DirFS(dir), dir, filename)
+}
+
+// SendFS is Send for the files of fsys, they're journaled by their paths in fsys.
+func (a *Archiver) SendFS(ctx context.Context, chatId int64, fsys fs.FS, filename string) ([]*tg.Message, error) {
+	return a.send(ctx, chatId, fsys, "", filename)
+}
+
+// send archives the files of fsys, dir is where fsys is on disk ("" if it isn't).
+func (a *Archiver) send(ctx context.Context, chatId int64, fsys fs.FS, dir string, filename string) (messages []*tg.Message, err error) {
 	filename = strings.TrimSuffix(filename, ".tar")
-	tmpdir, err := os.MkdirTemp("", "tgarchive_*")
+	ws, err := tgtemp.New(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer func(name string) {
-		if e := os.RemoveAll(name); e != nil && err == nil {
+	defer func() {
+		if e := ws.Close(); e != nil && err == nil {
 			err = e
 		}
-	}(tmpdir)
-
-	files := []*os.File{}
-	file, err := os.OpenFile(path.Join(tmpdir, fmt.Sprintf("%s.tar", filename)), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	}()
+	tmpdir, err := ws.Mkdir("tgarchive_*")
 	if err != nil {
 		return nil, err
 	}
-	files = append(files, file)
-	defer func() {
-		for _, f := range files {
-			_ = f.Close()
-			if e := os.Remove(f.Name()); e != nil && err == nil {
-				err = e
-			}
-		}
-	}()
 
-	tarWriters := []*tar.Writer{}
-	defer func() {
-		for _, w := range tarWriters {
-			_ = w.Close()
-		}
-	}()
-	tarWriter := tar.NewWriter(file)
-	tarWriters = append(tarWriters, tarWriter)
-	tarSize := int64(0)
 	iteration := 1
-
-	fsys := os.DirFS(dir)
-	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+	current, err := a.open(tmpdir, filename, iteration)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = current.file.Close() }()
+	rotate := func() error {
+		msg, err := a.sendChunk(ctx, chatId, current)
+		if msg != nil {
+			messages = append(messages, msg)
+		}
 		if err != nil {
 			return err
 		}
-		if name == "." {
-			return nil
+		_ = current.file.Close()
+		iteration += 1
+		current, err = a.open(tmpdir, filename, iteration)
+		return err
+	}
+
+	dirs := map[string]fs.FileInfo{}
+	err = a.Filter.WalkDir(fsys, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || name == "." || !d.IsDir() {
+			return err
 		}
 		info, err := d.Info()
 		if err != nil {
 			return err
 		}
+		dirs[name] = info
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	files, err := a.Filter.Walk(fsys, a.Order, a.Subdirs)
+	if err != nil {
+		return nil, err
+	}
 
-		if !d.IsDir() && !info.Mode().IsRegular() {
-			return errors.New("tgarchive: cannot add non-regular file")
+	archived := map[string]bool{}
+	lastDir := ""
+	for _, report := range files {
+		name := report.Path
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			return messages, err
+		}
+		if !info.Mode().IsRegular() {
+			return messages, errors.New("tgarchive: cannot add non-regular file")
 		}
-		if info.Size() > n {
-			return fmt.Errorf("tgarchive: file too large (%d > %d)", info.Size(), n)
+		size := info.Size()
+		if size > a.ChunkSize {
+			return messages, fmt.Errorf("tgarchive: file too large (%d > %d)", size, a.ChunkSize)
+		}
+		file := &member{fsys: fsys, path: name, info: info}
+		if dir != "" {
+			file = &member{path: filepath.Join(dir, name), info: info}
+		}
+		if _, ok := file.delivered(a.Journal, chatId); ok {
+			continue
 		}
 
-		if tarSize+info.Size() <= n {
-			tarSize += info.Size()
-			h, err := tar.FileInfoHeader(info, "")
-			if err != nil {
-				return err
-			}
-			h.Name = name
-			if d.IsDir() {
-				h.Name += "/"
-			}
-			if err := tarWriter.WriteHeader(h); err != nil {
-				return err
-			}
-			if d.IsDir() {
-				return nil
-			}
-			f, err := fsys.Open(name)
-			if err != nil {
-				return err
+		newDir := a.Subdirs == tgdir.SubdirsGrouped && path.Dir(name) != lastDir
+		lastDir = path.Dir(name)
+		if len(current.members) > 0 && (newDir || current.size+size > a.ChunkSize) {
+			if err := rotate(); err != nil {
+				return messages, err
 			}
-			defer f.Close()
-			_, err = io.Copy(tarWriter, f)
-			return err
 		}
-
-		if err := tarWriter.Flush(); err != nil {
-			return err
+		if err := current.writeDirs(path.Dir(name), dirs); err != nil {
+			return messages, err
 		}
-		msg, err := tg.SendDocument(ctx, chatId, tg.FromDisk(file.Name()), opt...)
-		if err != nil {
-			return err
+		if err := current.write(fsys, name, info); err != nil {
+			return messages, err
 		}
-		messages = append(messages, msg)
+		current.size += size
+		current.members = append(current.members, file)
+		for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+			archived[parent] = true
+		}
+	}
 
-		iteration += 1
-		file, err = os.OpenFile(path.Join(tmpdir, fmt.Sprintf("%s_%02d.tar", filename, iteration)), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if len(current.members) > 0 {
+		// the directories without files are kept too, in the last archive.
+		for _, name := range slices.Sorted(maps.Keys(dirs)) {
+			if !archived[name] {
+				if err := current.writeDirs(name, dirs); err != nil {
+					return messages, err
+				}
+			}
+		}
+		msg, err := a.sendChunk(ctx, chatId, current)
+		if msg != nil {
+			messages = append(messages, msg)
+		}
 		if err != nil {
-			return err
+			return messages, err
 		}
-		files = append(files, file)
+	}
+	return messages, nil
+}
 
-		tarWriter = tar.NewWriter(file)
-		tarWriters = append(tarWriters, tarWriter)
-		tarSize = 0
+// writeDirs writes the headers of dir and its parents the archive doesn't have yet.
+func (c *chunk) writeDirs(dir string, infos map[string]fs.FileInfo) error {
+	if dir == "." || c.dirs[dir] {
 		return nil
-	})
+	}
+	if err := c.writeDirs(path.Dir(dir), infos); err != nil {
+		return err
+	}
+	info, ok := infos[dir]
+	if !ok {
+		return nil
+	}
+	h, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	h.Name = dir + "/"
+	if err := c.writer.WriteHeader(h); err != nil {
+		return err
+	}
+	c.dirs[dir] = true
+	return nil
+}
 
-	if tarSize != 0 {
-		msg, err := tg.SendDocument(ctx, chatId, tg.FromDisk(file.Name()), opt...)
-		if err != nil {
-			return messages, err
+// write writes the file name of fsys to the archive.
+func (c *chunk) write(fsys fs.FS, name string, info fs.FileInfo) error {
+	h, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	h.Name = name
+	if err := c.writer.WriteHeader(h); err != nil {
+		return err
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(c.writer, f)
+	return err
+}
+
+func (a *Archiver) open(tmpdir string, filename string, iteration int) (*chunk, error) {
+	name := fmt.Sprintf("%s.tar", filename)
+	if iteration > 1 {
+		name = fmt.Sprintf("%s_%02d.tar", filename, iteration)
+	}
+	file, err := os.OpenFile(path.Join(tmpdir, name), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &chunk{file: file, writer: tar.NewWriter(file), dirs: map[string]bool{}}, nil
+}
+
+// sendChunk finishes the archive, sends it and journals its files.
+func (a *Archiver) sendChunk(ctx context.Context, chatId int64, current *chunk) (*tg.Message, error) {
+	if err := current.writer.Close(); err != nil {
+		return nil, err
+	}
+	opts := []*tg.OptSendDocument{}
+	if a.Document != nil {
+		opts = append(opts, a.Document)
+	}
+	msg, err := tgsend.Document(ctx, chatId, current.file.Name(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range current.members {
+		if err := member.record(a.Journal, chatId, []int64{msg.MessageId}); err != nil {
+			return msg, err
 		}
-		messages = append(messages, msg)
 	}
+	return msg, nil
+}
+
+func (m *member) delivered(journal *tgjournal.Journal, chatId int64) (*tgjournal.Entry, bool) {
+	if m.fsys == nil {
+		return journal.Delivered(chatId, m.path, m.info)
+	}
+	return journal.DeliveredFS(chatId, m.fsys, m.path, m.info)
+}
 
-	return messages, err
+func (m *member) record(journal *tgjournal.Journal, chatId int64, messageIds []int64) error {
+	if m.fsys == nil {
+		return journal.Record(chatId, m.path, m.info, messageIds)
+	}
+	return journal.RecordFS(chatId, m.fsys, m.path, m.info, messageIds)
 }
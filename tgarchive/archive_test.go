@@ -3,7 +3,10 @@ package tgarchive
 import (
 	"github.com/kittenbark/tg"
 	"github.com/kittenbark/tgmedia/tgdir"
+	"github.com/kittenbark/tgmedia/tgjournal"
+	"github.com/kittenbark/tgmedia/tgsend"
 	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 )
@@ -32,6 +35,29 @@ func TestSendByN_Bad(t *testing.T) {
 	}
 }
 
+func TestArchiver_Journal(t *testing.T) {
+	t.Parallel()
+
+	journal, err := tgjournal.Open(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	archiver := &Archiver{ChunkSize: 20 << 20, Journal: journal}
+	messages, err := archiver.Send(bot.Context(), chat, "./data", "journaled.tar")
+	if err != nil || len(messages) == 0 {
+		t.Fatal(err, messages)
+	}
+	resumed, err := archiver.Send(bot.Context(), chat, "./data", "journaled.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed) != 0 {
+		t.Fatal("everything was expected to be delivered already", resumed)
+	}
+}
+
 func TestTgdir(t *testing.T) {
 	t.Parallel()
 
@@ -50,4 +76,29 @@ func TestTgdir(t *testing.T) {
 			t.Fatal(err)
 		}
 	})
+
+	t.Run("report", func(t *testing.T) {
+		t.Parallel()
+		sender := &tgdir.Sender{Grouped: true, ContinueOnError: true}
+		report, err := sender.Send(bot.Context(), chat, "./data")
+		if err != nil {
+			t.Fatal(err, report.Failed())
+		}
+		for _, file := range report.Files {
+			if len(file.Messages) != 1 || file.Bytes == 0 || file.Kind == "" {
+				t.Fatal("unexpected file report", file)
+			}
+		}
+	})
+
+	t.Run("fanout", func(t *testing.T) {
+		t.Parallel()
+		results := tgdir.SendGroupedFanout(bot.Context(), []*tgsend.Target{{ChatId: chat}, {ChatId: chat}}, "./data")
+		if err := tgsend.FanoutErr(results); err != nil {
+			t.Fatal(err)
+		}
+		if !results[1].Copied || len(results[1].MessageIds) != len(results[0].MessageIds) {
+			t.Fatal("the second chat was expected to get copies", results[1])
+		}
+	})
 }
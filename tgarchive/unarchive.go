@@ -5,18 +5,24 @@ import (
 	"archive/zip"
 	"compress/gzip"
 	"context"
-	"errors"
 	"fmt"
 	"github.com/kittenbark/tg"
 	"github.com/kittenbark/tgmedia/tgdir"
+	"github.com/kittenbark/tgmedia/tgsniff"
+	"github.com/kittenbark/tgmedia/tgtemp"
 	"io"
 	"os"
 	"path"
-	"path/filepath"
 )
 
 func SendUnpacked(ctx context.Context, chatId int64, filename string, opts ...*tgdir.Opt) ([]*tg.Message, error) {
-	dir, err := unpack(filename)
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.Close()
+
+	dir, err := unpack(ws, filename)
 	if err != nil {
 		return nil, err
 	}
@@ -24,26 +30,25 @@ func SendUnpacked(ctx context.Context, chatId int64, filename string, opts ...*t
 	return tgdir.SendDocs(ctx, chatId, dir, opts...)
 }
 
-func unpack(filename string) (dir string, err error) {
-	dir, err = os.MkdirTemp("", "tgmedia_*")
+func unpack(ws *tgtemp.Workspace, filename string) (dir string, err error) {
+	dir, err = ws.Mkdir("unpacked_*")
 	if err != nil {
 		return "", err
 	}
-	defer func() {
-		if err != nil {
-			_ = os.RemoveAll(dir)
-		}
-	}()
 
-	switch filepath.Ext(filename) {
-	case ".tar":
+	typ, err := tgsniff.File(filename)
+	if err != nil {
+		return "", err
+	}
+	switch typ {
+	case tgsniff.Tar:
 		return dir, unpackTar(filename, dir)
-	case ".tar.gz":
+	case tgsniff.Gzip:
 		return dir, unpackTarGz(filename, dir)
-	case ".zip":
+	case tgsniff.Zip:
 		return dir, unpackZip(filename, dir)
 	default:
-		return "", errors.New("file type unsupported (.tar/.zip only)")
+		return "", fmt.Errorf("file type %s unsupported (.tar/.tar.gz/.zip only)", typ)
 	}
 }
 
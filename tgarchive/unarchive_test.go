@@ -1,8 +1,14 @@
 package tgarchive
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
 	"fmt"
 	"github.com/kittenbark/tgmedia/tgdir"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -20,3 +26,41 @@ func TestSendUnpacked(t *testing.T) {
 		})
 	}
 }
+
+func TestUnpack(t *testing.T) {
+	t.Parallel()
+
+	ws, err := tgtemp.New(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// a .tar.gz downloaded as .bin.
+	filename := filepath.Join(t.TempDir(), "download.bin")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := gzip.NewWriter(file)
+	writer := tar.NewWriter(compressed)
+	if err := writer.WriteHeader(&tar.Header{Name: "notes.txt", Mode: 0644, Size: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte("notes")); err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{writer.Close(), compressed.Close(), file.Close()} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir, err := unpack(ws, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "notes.txt")); err != nil || string(data) != "notes" {
+		t.Fatal("expected notes.txt unpacked", string(data), err)
+	}
+}
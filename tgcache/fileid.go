@@ -0,0 +1,143 @@
+package tgcache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+// Kind is the kind of media a file_id was issued for, the same file sent as a video and as a document
+// gets different ids.
+type Kind string
+
+const (
+	KindPhoto    Kind = "photo"
+	KindVideo    Kind = "video"
+	KindDocument Kind = "document"
+)
+
+// FileIdStore remembers the file_id Telegram returned for an upload by a key of its content (see Hash and
+// Key), so the same media is sent again without uploading. File ids are only valid for the bot they were
+// issued to, don't share a store between bots.
+type FileIdStore interface {
+	Get(key string, kind Kind) (fileId string, ok bool)
+	Put(key string, kind Kind, fileId string) error
+	Delete(key string, kind Kind) error
+}
+
+type fileIdKey struct {
+	Key  string
+	Kind Kind
+}
+
+// MemoryStore is a FileIdStore living as long as the process.
+type MemoryStore struct {
+	mu  sync.RWMutex
+	ids map[fileIdKey]string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ids: map[fileIdKey]string{}}
+}
+
+func (s *MemoryStore) Get(key string, kind Kind) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fileId, ok := s.ids[fileIdKey{key, kind}]
+	return fileId, ok
+}
+
+func (s *MemoryStore) Put(key string, kind Kind, fileId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[fileIdKey{key, kind}] = fileId
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string, kind Kind) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ids, fileIdKey{key, kind})
+	return nil
+}
+
+// FileStore is a FileIdStore kept in a file of json lines. Changes are appended, so processes sharing the
+// file don't overwrite each other, though each one only sees the ids that were there when it opened it.
+type FileStore struct {
+	memory *MemoryStore
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+type fileStoreLine struct {
+	Key  string `json:"key"`
+	Kind Kind   `json:"kind"`
+	// FileId is empty for deleted ids.
+	FileId string `json:"file_id"`
+}
+
+// OpenFileStore opens (creating if needed) the store in filename, it must be closed.
+func OpenFileStore(filename string) (*FileStore, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &FileStore{memory: NewMemoryStore(), file: file}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := fileStoreLine{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			// a line cut off by a crash, whatever follows is still fine.
+			continue
+		}
+		if line.FileId == "" {
+			_ = store.memory.Delete(line.Key, line.Kind)
+			continue
+		}
+		_ = store.memory.Put(line.Key, line.Kind, line.FileId)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Join(err, file.Close())
+	}
+	return store, nil
+}
+
+func (s *FileStore) Get(key string, kind Kind) (string, bool) {
+	return s.memory.Get(key, kind)
+}
+
+func (s *FileStore) Put(key string, kind Kind, fileId string) error {
+	if err := s.append(&fileStoreLine{Key: key, Kind: kind, FileId: fileId}); err != nil {
+		return err
+	}
+	return s.memory.Put(key, kind, fileId)
+}
+
+func (s *FileStore) Delete(key string, kind Kind) error {
+	if err := s.append(&fileStoreLine{Key: key, Kind: kind}); err != nil {
+		return err
+	}
+	return s.memory.Delete(key, kind)
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileStore) append(line *fileStoreLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// a single write of a whole line, appends of other processes don't interleave with it.
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,42 @@
+package tgcache
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), "file_ids.jsonl")
+	store, err := OpenFileStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		store.Put("a", KindVideo, "video_a"),
+		store.Put("a", KindDocument, "document_a"),
+		store.Put("b", KindPhoto, "photo_b"),
+		store.Delete("b", KindPhoto),
+		store.Close(),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := OpenFileStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if fileId, ok := reopened.Get("a", KindVideo); !ok || fileId != "video_a" {
+		t.Fatal("unexpected video file_id", fileId, ok)
+	}
+	if fileId, ok := reopened.Get("a", KindDocument); !ok || fileId != "document_a" {
+		t.Fatal("unexpected document file_id", fileId, ok)
+	}
+	if fileId, ok := reopened.Get("b", KindPhoto); ok {
+		t.Fatal("deleted file_id is back", fileId)
+	}
+}
@@ -0,0 +1,273 @@
+package tgcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hash returns the hex sha256 of the file's content.
+func Hash(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return HashReader(file)
+}
+
+// HashReader returns the hex sha256 of everything read from reader.
+func HashReader(reader io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Key combines parts (e.g. a content hash and encoding parameters) into a cache key.
+func Key(parts ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(hash[:])
+}
+
+// evictionGrace keeps recently used entries from being evicted, someone may be about to read them.
+const evictionGrace = time.Minute
+
+// Dir is an on-disk cache, an entry is a directory of files named by its key. It's safe to use from many
+// goroutines and processes: entries are built aside and renamed into place, a reader never sees a half-written one.
+type Dir struct {
+	path string
+	// MaxSize is the total size of the entries in bytes, least recently used ones are evicted past it. Zero
+	// means unlimited.
+	MaxSize int64
+	// MaxAge evicts entries not used for longer, zero means forever.
+	MaxAge time.Duration
+	// OnEvictError is called with the errors of the evictions Do and EvictEvery run, nil ignores them. The
+	// entry Do stored is returned all the same.
+	OnEvictError func(err error)
+
+	mu       sync.Mutex
+	inflight map[string]*sync.WaitGroup
+}
+
+// Open opens (creating if needed) a cache in the directory path.
+func Open(path string, maxSize int64, maxAge time.Duration) (*Dir, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	return &Dir{path: path, MaxSize: maxSize, MaxAge: maxAge, inflight: map[string]*sync.WaitGroup{}}, nil
+}
+
+// Path is the directory of the cache.
+func (d *Dir) Path() string {
+	return d.path
+}
+
+// Get returns the directory of the entry and marks it as used, ok is false if there is no such entry.
+func (d *Dir) Get(key string) (dir string, ok bool) {
+	dir = filepath.Join(d.path, key)
+	if _, err := os.Stat(dir); err != nil {
+		return "", false
+	}
+	now := time.Now()
+	_ = os.Chtimes(dir, now, now)
+	return dir, true
+}
+
+// Do returns the directory of the entry, calling build to fill it (in an empty directory) when it's missing.
+// Concurrent calls for the same key in the process wait for a single build.
+func (d *Dir) Do(key string, build func(dir string) error) (string, error) {
+	for {
+		if dir, ok := d.Get(key); ok {
+			return dir, nil
+		}
+
+		d.mu.Lock()
+		if wg, ok := d.inflight[key]; ok {
+			d.mu.Unlock()
+			wg.Wait()
+			continue
+		}
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		d.inflight[key] = wg
+		d.mu.Unlock()
+
+		dir, err := d.put(key, build)
+
+		d.mu.Lock()
+		delete(d.inflight, key)
+		d.mu.Unlock()
+		wg.Done()
+		return dir, err
+	}
+}
+
+func (d *Dir) put(key string, build func(dir string) error) (string, error) {
+	tmp, err := os.MkdirTemp(d.path, ".tmp_*")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+
+	if err := build(tmp); err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(d.path, key)
+	if err := os.Rename(tmp, dir); err != nil {
+		// another process has built it meanwhile, use theirs.
+		if existing, ok := d.Get(key); ok {
+			return existing, nil
+		}
+		return "", fmt.Errorf("tgcache: failed to store %s: %w", key, err)
+	}
+	d.evict()
+	return dir, nil
+}
+
+// evict runs Evict, reporting its error to OnEvictError.
+func (d *Dir) evict() {
+	if err := d.Evict(); err != nil && d.OnEvictError != nil {
+		d.OnEvictError(err)
+	}
+}
+
+// EvictEvery runs Evict every interval until ctx is done, errors go to OnEvictError. Do evicts only when it
+// stores an entry, a cache that's mostly read needs this for MaxAge, e.g. go cache.EvictEvery(ctx, time.Hour).
+func (d *Dir) EvictEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.evict()
+		}
+	}
+}
+
+// Evict removes the entries past MaxAge and, least recently used first, the ones past MaxSize. The entries
+// left half-built or half-removed by a crashed process are removed too.
+func (d *Dir) Evict() error {
+	type entry struct {
+		path    string
+		size    int64
+		lastUse time.Time
+	}
+
+	dirEntries, err := os.ReadDir(d.path)
+	if err != nil {
+		return err
+	}
+	entries := []*entry{}
+	total := int64(0)
+	errs := []error{}
+	now := time.Now()
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		if name := dirEntry.Name(); strings.HasPrefix(name, ".tmp_") || strings.HasPrefix(name, ".trash_") {
+			// a build still writes its files, a crashed one stopped.
+			path := filepath.Join(d.path, name)
+			if lastWrite, err := lastModified(path); err == nil && now.Sub(lastWrite) > evictionGrace {
+				if err := os.RemoveAll(path); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(dirEntry.Name(), ".") {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		e := &entry{path: filepath.Join(d.path, dirEntry.Name()), lastUse: info.ModTime()}
+		e.size, _ = dirSize(e.path)
+		total += e.size
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b *entry) int { return a.lastUse.Compare(b.lastUse) })
+
+	for _, e := range entries {
+		if now.Sub(e.lastUse) < evictionGrace {
+			break
+		}
+		expired := d.MaxAge > 0 && now.Sub(e.lastUse) > d.MaxAge
+		oversized := d.MaxSize > 0 && total > d.MaxSize
+		if !expired && !oversized {
+			continue
+		}
+		if err := remove(e.path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		total -= e.size
+	}
+	return errors.Join(errs...)
+}
+
+// remove renames the entry out of the way first, so it disappears at once for other readers.
+func remove(path string) error {
+	trash := filepath.Join(filepath.Dir(path), fmt.Sprintf(".trash_%s_%d", filepath.Base(path), time.Now().UnixNano()))
+	if err := os.Rename(path, trash); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return os.RemoveAll(trash)
+}
+
+// lastModified is the latest modification time of path and the files in it.
+func lastModified(path string) (time.Time, error) {
+	latest := time.Time{}
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest, err
+}
+
+func dirSize(path string) (int64, error) {
+	total := int64(0)
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
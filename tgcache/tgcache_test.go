@@ -0,0 +1,103 @@
+package tgcache
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDir(t *testing.T) {
+	t.Parallel()
+
+	cache, err := Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builds := atomic.Int64{}
+	wg := sync.WaitGroup{}
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dir, err := cache.Do(Key("input", "preset=fast"), func(dir string) error {
+				builds.Add(1)
+				time.Sleep(10 * time.Millisecond)
+				return os.WriteFile(filepath.Join(dir, "video.mp4"), []byte("video"), 0644)
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if data, err := os.ReadFile(filepath.Join(dir, "video.mp4")); err != nil || string(data) != "video" {
+				t.Error("unexpected entry", string(data), err)
+			}
+		}()
+	}
+	wg.Wait()
+	if builds.Load() != 1 {
+		t.Fatal("expected a single build, got", builds.Load())
+	}
+
+	if Key("input", "preset=fast") == Key("input", "preset=slow") || Key("a", "bc") == Key("ab", "c") {
+		t.Fatal("keys were expected to differ")
+	}
+}
+
+func TestDir_Evict(t *testing.T) {
+	t.Parallel()
+
+	cache, err := Open(t.TempDir(), 10, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(key string, size int, lastUse time.Time) string {
+		dir, err := cache.Do(key, func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "data"), make([]byte, size), 0644)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(dir, lastUse, lastUse); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	now := time.Now()
+	expired := put("expired", 1, now.Add(-48*time.Hour))
+	oldest := put("oldest", 6, now.Add(-3*time.Hour))
+	older := put("older", 3, now.Add(-2*time.Hour))
+	recent := put("recent", 3, now)
+	// left by a crashed process, and a build going on.
+	crashed, building := filepath.Join(cache.Path(), ".tmp_crashed"), filepath.Join(cache.Path(), ".tmp_building")
+	for _, dir := range []string{crashed, building} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "data"), make([]byte, 1), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{crashed, filepath.Join(crashed, "data")} {
+		if err := os.Chtimes(name, now.Add(-time.Hour), now.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cache.Evict(); err != nil {
+		t.Fatal(err)
+	}
+	for dir, kept := range map[string]bool{expired: false, oldest: false, older: true, recent: true, crashed: false, building: true} {
+		if _, err := os.Stat(dir); (err == nil) != kept {
+			t.Error(dir, "kept:", err == nil, "expected:", kept)
+		}
+	}
+	// entries used within evictionGrace are never evicted, whatever the size.
+	if _, ok := cache.Get("recent"); !ok {
+		t.Fatal("recent entry was expected to be cached")
+	}
+}
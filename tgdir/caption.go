@@ -0,0 +1,270 @@
+package tgdir
+
+import (
+	"context"
+	"fmt"
+	"github.com/kittenbark/tgmedia/tgsend"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"github.com/kittenbark/tgmedia/tgvideo"
+	"html"
+	"path"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// Parse modes of captions.
+const (
+	ParseModeHTML       = "HTML"
+	ParseModeMarkdownV2 = "MarkdownV2"
+	ParseModeMarkdown   = "Markdown"
+)
+
+// escapeFunc is the function escaping what caption templates print, the pipelines end with it.
+const escapeFunc = "_escape"
+
+// Caption is the caption of every file of a Sender, albums have it on their first item.
+type Caption struct {
+	tmpl      *template.Template
+	text      string
+	parseMode string
+}
+
+// NewCaption parses text, a text/template executed with a CaptionData, e.g.
+//
+//	<b>{{.Name}}</b> {{.Index}}/{{.Total}}{{if .Date.IsZero | not}}, {{.Date.Format "2006-01-02"}}{{end}}
+//
+// parseMode is "" (plain text), ParseModeHTML, ParseModeMarkdownV2 or ParseModeMarkdown. The values the
+// template prints are escaped for it (except the ones passed through raw), the rest is markup. Captions
+// are cut to Telegram's limit of 1024 characters, the markup is kept valid.
+func NewCaption(text string, parseMode string) (*Caption, error) {
+	escape := escaper(parseMode)
+	tmpl, err := template.New("caption").Funcs(template.FuncMap{
+		escapeFunc: func(value any) string {
+			if raw, ok := value.(Raw); ok {
+				return string(raw)
+			}
+			return escape(fmt.Sprint(value))
+		},
+		"raw": func(value any) Raw { return Raw(fmt.Sprint(value)) },
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse caption: %w", err)
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			escapeList(t.Tree.Root)
+		}
+	}
+	return &Caption{tmpl: tmpl, parseMode: parseMode}, nil
+}
+
+// StaticCaption is the same text for every file, it's already in parseMode.
+func StaticCaption(text string, parseMode string) *Caption {
+	return &Caption{text: text, parseMode: parseMode}
+}
+
+// Raw is printed by a caption template as is, it's markup: {{raw .Something}}.
+type Raw string
+
+// ParseMode is the parse mode of the caption.
+func (c *Caption) ParseMode() string {
+	return c.parseMode
+}
+
+// Execute builds the caption of data, cut to the limit.
+func (c *Caption) Execute(data *CaptionData) (string, error) {
+	text := c.text
+	if c.tmpl != nil {
+		builder := &strings.Builder{}
+		if err := c.tmpl.Execute(builder, data); err != nil {
+			return "", fmt.Errorf("failed to build caption of %s: %w", data.Path, err)
+		}
+		text = builder.String()
+	}
+	return tgsend.TruncateCaption(text, c.parseMode, captionLimit), nil
+}
+
+// CaptionData is what a caption template sees of a file.
+type CaptionData struct {
+	// Name is the file name, Path is its slash-separated path in the directory (or FS) sent.
+	Name string
+	Path string
+	// Index is the number of the file among the Total files sent, from 1.
+	Index int
+	Total int
+	// Size is the file size in bytes.
+	Size int64
+	// Album is the number of the album the file is in, from 1, 0 when it's sent by itself.
+	Album int
+
+	ctx  context.Context
+	file *FileReport
+	// filename is the file on disk, ws is where to spool it from an FS if it's needed.
+	filename string
+	ws       *tgtemp.Workspace
+	probed   bool
+	width    int
+	height   int
+	duration time.Duration
+}
+
+// Duration is the duration of a video (ffprobe), 0 for other files.
+func (data *CaptionData) Duration() time.Duration {
+	data.probe()
+	return data.duration
+}
+
+// Width is the width of a photo or video, 0 if it's unknown.
+func (data *CaptionData) Width() int {
+	data.probe()
+	return data.width
+}
+
+// Height is the height of a photo or video, 0 if it's unknown.
+func (data *CaptionData) Height() int {
+	data.probe()
+	return data.height
+}
+
+// Resolution is WIDTHxHEIGHT of a photo or video, "" if it's unknown.
+func (data *CaptionData) Resolution() string {
+	if data.Width() == 0 || data.Height() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", data.width, data.height)
+}
+
+// Date is when a photo was taken (EXIF, see tgphoto.Taken) or a video recorded, the zero time if it's
+// unknown.
+func (data *CaptionData) Date() time.Time {
+	taken, _ := data.file.taken()
+	return taken
+}
+
+// probe reads the size (and duration) of the file once, only the templates using them pay for it.
+func (data *CaptionData) probe() {
+	if data.probed {
+		return
+	}
+	data.probed = true
+	switch data.file.Kind {
+	case KindPhoto:
+		data.width, data.height, _ = dimensions(data.file)
+	case KindVideo:
+		if data.filename == "" && data.ws != nil {
+			data.filename, _ = data.file.spool(data.ws)
+		}
+		if data.filename == "" {
+			return
+		}
+		if meta, err := tgvideo.Probe(data.ctx, data.filename); err == nil {
+			data.width, data.height = int(meta.Width), int(meta.Height)
+			data.duration = time.Duration(meta.Duration) * time.Second
+		}
+	}
+}
+
+// captionData is the data of file for the caption template.
+func (s *Sender) captionData(ctx context.Context, file *FileReport, index int, total int, album int) *CaptionData {
+	if s.Caption == nil {
+		return nil
+	}
+	return &CaptionData{
+		Name:  path.Base(file.rel),
+		Path:  file.rel,
+		Index: index,
+		Total: total,
+		Size:  file.Bytes,
+		Album: album,
+		ctx:   ctx,
+		file:  file,
+	}
+}
+
+// moved is data for file taking the place of data's file, at offset in its album: the first file of an
+// album may fail and be left out.
+func (data *CaptionData) moved(file *FileReport, offset int) *CaptionData {
+	if data == nil || data.file == file {
+		return data
+	}
+	return &CaptionData{
+		Name:  path.Base(file.rel),
+		Path:  file.rel,
+		Index: data.Index + offset,
+		Total: data.Total,
+		Size:  file.Bytes,
+		Album: data.Album,
+		ctx:   data.ctx,
+		file:  file,
+	}
+}
+
+// withCaption is s with caption in the options of every kind.
+func (s *Sender) withCaption(caption string) *Sender {
+	sender := *s
+	photo, video, document := *s.photo(), *s.video(), *s.document()
+	photo.Caption, photo.ParseMode, photo.CaptionEntities = caption, s.Caption.parseMode, nil
+	video.Caption, video.ParseMode, video.CaptionEntities = caption, s.Caption.parseMode, nil
+	document.Caption, document.ParseMode, document.CaptionEntities = caption, s.Caption.parseMode, nil
+	sender.Photo, sender.Video, sender.Document = &photo, &video, &document
+	return &sender
+}
+
+// escapeList makes every action printing a value of list end with escapeFunc.
+func escapeList(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *parse.ActionNode:
+			if len(node.Pipe.Decl) > 0 {
+				// an assignment, nothing is printed.
+				continue
+			}
+			node.Pipe.Cmds = append(node.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      node.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(escapeFunc).SetPos(node.Pos)},
+			})
+		case *parse.IfNode:
+			escapeList(node.List)
+			escapeList(node.ElseList)
+		case *parse.RangeNode:
+			escapeList(node.List)
+			escapeList(node.ElseList)
+		case *parse.WithNode:
+			escapeList(node.List)
+			escapeList(node.ElseList)
+		}
+	}
+}
+
+// escaper escapes plain text for parseMode.
+func escaper(parseMode string) func(string) string {
+	switch parseMode {
+	case ParseModeHTML:
+		return html.EscapeString
+	case ParseModeMarkdownV2:
+		return backslashed("_*[]()~`>#+-=|{}.!\\")
+	case ParseModeMarkdown:
+		return backslashed("_*`[")
+	default:
+		return func(text string) string { return text }
+	}
+}
+
+func backslashed(special string) func(string) string {
+	return func(text string) string {
+		builder := &strings.Builder{}
+		for _, r := range text {
+			if strings.ContainsRune(special, r) {
+				builder.WriteByte('\\')
+			}
+			builder.WriteRune(r)
+		}
+		return builder.String()
+	}
+}
@@ -0,0 +1,51 @@
+package tgdir
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestCaption(t *testing.T) {
+	t.Parallel()
+
+	data := &CaptionData{Name: "a_b<1>.jpg", Path: "trip/a_b<1>.jpg", Index: 2, Total: 10, Size: 2048, Album: 1}
+	for _, test := range []struct {
+		text      string
+		parseMode string
+		expected  string
+	}{
+		{"{{.Name}} {{.Index}}/{{.Total}}", "", "a_b<1>.jpg 2/10"},
+		{"<b>{{.Path}}</b>{{if .Album}} #{{.Album}}{{end}}", ParseModeHTML, "<b>trip/a_b&lt;1&gt;.jpg</b> #1"},
+		{"*{{.Name}}* {{raw \"_raw_\"}}", ParseModeMarkdownV2, "*a\\_b<1\\>\\.jpg* _raw_"},
+		{"{{$size := .Size}}{{.Name}}: {{$size}}", ParseModeMarkdown, "a\\_b<1>.jpg: 2048"},
+	} {
+		caption, err := NewCaption(test.text, test.parseMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, err := caption.Execute(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.text, test.expected, text)
+		}
+	}
+}
+
+func TestTruncateCaption(t *testing.T) {
+	t.Parallel()
+
+	caption, err := NewCaption("{{.Name}}", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := caption.Execute(&CaptionData{Name: strings.Repeat("😀", 1000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(utf16.Encode([]rune(text))); n > captionLimit {
+		t.Fatal("caption over the limit", n)
+	}
+}
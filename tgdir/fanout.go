@@ -0,0 +1,22 @@
+package tgdir
+
+import (
+	"context"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgsend"
+)
+
+// SendFanout is Send to every target: videos are transcoded and files uploaded once, then the messages
+// are copied to the other chats, see tgsend.Fanout.
+func SendFanout(ctx context.Context, targets []*tgsend.Target, dir string, opts ...*Opt) []*tgsend.FanoutResult {
+	return tgsend.Fanout(ctx, targets, func(ctx context.Context, target *tgsend.Target) ([]*tg.Message, error) {
+		return Send(ctx, target.ChatId, dir, tgsend.TargetOpts(opts, target, func(opt *Opt) (*int64, *bool) { return &opt.MessageThreadId, &opt.DisableNotification })...)
+	})
+}
+
+// SendGroupedFanout is SendGrouped to every target, albums stay albums in the copies, see tgsend.Fanout.
+func SendGroupedFanout(ctx context.Context, targets []*tgsend.Target, dir string, opts ...*Opt) []*tgsend.FanoutResult {
+	return tgsend.Fanout(ctx, targets, func(ctx context.Context, target *tgsend.Target) ([]*tg.Message, error) {
+		return SendGrouped(ctx, target.ChatId, dir, tgsend.TargetOpts(opts, target, func(opt *Opt) (*int64, *bool) { return &opt.MessageThreadId, &opt.DisableNotification })...)
+	})
+}
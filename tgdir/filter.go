@@ -0,0 +1,313 @@
+package tgdir
+
+import (
+	"bufio"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFile is the name of the files listing what to leave out of their directory, with the syntax and
+// semantics of .gitignore.
+const IgnoreFile = ".tgignore"
+
+// Excluded are the patterns every Filter excludes on top of its own: system junk and the files still
+// being downloaded or written by common tools. Set it to nil to keep them.
+var Excluded = []string{
+	"Thumbs.db",
+	"desktop.ini",
+	"*.part",
+	"*.partial",
+	"*.tmp",
+	"*.crdownload",
+	"*.download",
+	"*.swp",
+}
+
+// Filter picks the files of a directory walk, nil is the zero Filter: every file but the hidden ones,
+// Excluded and the ones .tgignore files leave out. A .tgignore applies to its directory and below, the
+// deeper ones and the later lines override, "!pattern" brings back what Excluded or a parent left out.
+type Filter struct {
+	// Include keeps only the files matching any of the patterns, every file when empty. Exclude leaves out
+	// the files and directories matching any of them, whatever .tgignore files say. Patterns are lines of
+	// .tgignore relative to the top directory, e.g. "*.jpg", "/raw/", "photos/**/*.png".
+	Include []string
+	Exclude []string
+	// Hidden keeps the files and directories starting with a dot.
+	Hidden bool
+	// NoIgnoreFiles doesn't read .tgignore files.
+	NoIgnoreFiles bool
+	// MaxDepth is how deep the files kept are, 1 keeps the top directory's files only, 0 means no limit.
+	MaxDepth int
+	// MinSize and MaxSize are the size bounds of the files kept in bytes, 0 means no bound.
+	MinSize int64
+	MaxSize int64
+}
+
+// WalkDir is fs.WalkDir of fsys from its root, calling fn only for the directories and files f keeps.
+// The errors of the walk go to fn as in fs.WalkDir, the ones reading .tgignore files are returned.
+func (f *Filter) WalkDir(fsys fs.FS, fn fs.WalkDirFunc) error {
+	if f == nil {
+		f = &Filter{}
+	}
+	include, err := parseRules(".", f.Include)
+	if err != nil {
+		return err
+	}
+	exclude, err := parseRules(".", f.Exclude)
+	if err != nil {
+		return err
+	}
+	excluded, err := parseRules(".", Excluded)
+	if err != nil {
+		return err
+	}
+	// ignored are the rules of the directories walked by their paths: Excluded and the .tgignore files.
+	ignored := map[string][]*rule{}
+
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fn(name, d, err)
+		}
+		if name == "." {
+			if ignored[name], err = f.readIgnore(fsys, name, excluded); err != nil {
+				return err
+			}
+			return fn(name, d, nil)
+		}
+		skip := func() error {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		depth := strings.Count(name, "/") + 1
+		switch {
+		case !f.Hidden && strings.HasPrefix(d.Name(), "."):
+			return skip()
+		case d.Name() == IgnoreFile:
+			return nil
+		case matchesAny(exclude, name, d.IsDir()), ignoredBy(ignored, name, d.IsDir()):
+			return skip()
+		case d.IsDir() && f.MaxDepth > 0 && depth >= f.MaxDepth:
+			return fs.SkipDir
+		case d.IsDir():
+			if ignored[name], err = f.readIgnore(fsys, name, nil); err != nil {
+				return err
+			}
+			return fn(name, d, nil)
+		case len(include) > 0 && !matchesAny(include, name, false):
+			return nil
+		}
+
+		if f.MinSize > 0 || f.MaxSize > 0 {
+			info, err := d.Info()
+			if err != nil {
+				return fn(name, d, err)
+			}
+			if info.Size() < f.MinSize || f.MaxSize > 0 && info.Size() > f.MaxSize {
+				return nil
+			}
+		}
+		return fn(name, d, nil)
+	})
+}
+
+// Walk lists the files of fsys f keeps in the order a Sender with order and subdirs sends them, by their
+// paths in fsys. Nothing is sniffed and no handler picked, the files are only read for the dates of
+// OrderDate.
+func (f *Filter) Walk(fsys fs.FS, order Order, subdirs Subdirs) ([]*FileReport, error) {
+	files, err := f.files(fsys, "")
+	if err != nil {
+		return nil, err
+	}
+	arrange(files, order, subdirs)
+	return files, nil
+}
+
+// files lists the files of fsys f keeps in the order of the walk, dir is where fsys is on disk ("" if it
+// isn't): the files of a directory are reported by their paths on disk.
+func (f *Filter) files(fsys fs.FS, dir string) ([]*FileReport, error) {
+	result := []*FileReport{}
+	err := f.WalkDir(fsys, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if dir == "" {
+			result = append(result, newFile(name, info, fsys))
+			return nil
+		}
+		file := newFile(filepath.Join(dir, name), info, nil)
+		file.rel = name
+		result = append(result, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readIgnore appends the rules of dir's .tgignore to rules.
+func (f *Filter) readIgnore(fsys fs.FS, dir string, rules []*rule) ([]*rule, error) {
+	if f.NoIgnoreFiles {
+		return rules, nil
+	}
+	file, err := fsys.Open(path.Join(dir, IgnoreFile))
+	if err != nil {
+		// most directories have none.
+		return rules, nil
+	}
+	defer file.Close()
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	parsed, err := parseRules(dir, lines)
+	if err != nil {
+		return nil, err
+	}
+	return append(rules, parsed...), nil
+}
+
+// rule is a line of a .tgignore.
+type rule struct {
+	// dir is the directory of the .tgignore, the pattern is relative to it.
+	dir     string
+	pattern *regexp.Regexp
+	negated bool
+	dirOnly bool
+}
+
+// parseRules parses .tgignore lines of dir, blank lines and comments are skipped.
+func parseRules(dir string, lines []string) ([]*rule, error) {
+	result := []*rule{}
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := &rule{dir: dir}
+		if after, ok := strings.CutPrefix(line, "!"); ok {
+			r.negated, line = true, after
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if after, ok := strings.CutSuffix(line, "/"); ok {
+			r.dirOnly, line = true, after
+		}
+		// a pattern with a slash is relative to dir, one without matches at any depth.
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		expr := globToRegexp(line)
+		if !anchored {
+			expr = "(?:.*/)?" + expr
+		}
+		pattern, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			return nil, err
+		}
+		r.pattern = pattern
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// globToRegexp translates a gitignore glob: "*" and "?" don't match slashes, "**" matches any directories.
+func globToRegexp(glob string) string {
+	builder := &strings.Builder{}
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			builder.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			builder.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			builder.WriteString(".*")
+			i++
+		case c == '*':
+			builder.WriteString("[^/]*")
+		case c == '?':
+			builder.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				builder.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			builder.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			builder.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return builder.String()
+}
+
+// matches tells whether the rule matches name, a path in the walked FS.
+func (r *rule) matches(name string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel := name
+	if r.dir != "." {
+		var ok bool
+		if rel, ok = strings.CutPrefix(name, r.dir+"/"); !ok {
+			return false
+		}
+	}
+	return r.pattern.MatchString(rel)
+}
+
+// ignoredBy tells whether the rules of name's parent directories leave it out, the last rule matching
+// wins and the deeper .tgignore files come last.
+func ignoredBy(ignored map[string][]*rule, name string, isDir bool) bool {
+	dirs := []string{}
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == "." {
+			break
+		}
+	}
+	result := false
+	for i := len(dirs) - 1; i >= 0; i-- {
+		for _, r := range ignored[dirs[i]] {
+			if r.matches(name, isDir) {
+				result = !r.negated
+			}
+		}
+	}
+	return result
+}
+
+// matchesAny tells whether any of the rules matches name, negations are ignored.
+func matchesAny(rules []*rule, name string, isDir bool) bool {
+	for _, r := range rules {
+		if r.matches(name, isDir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package tgdir
+
+import (
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"photo.jpg":             {Data: []byte("photo")},
+		"big.mp4":               {Data: make([]byte, 1000)},
+		"empty.txt":             {},
+		"video.mp4.part":        {Data: []byte("partial")},
+		"Thumbs.db":             {Data: []byte("junk")},
+		".DS_Store":             {Data: []byte("junk")},
+		".git/HEAD":             {Data: []byte("ref")},
+		".tgignore":             {Data: []byte("# drafts\n*.psd\nraw/\n!keep.psd\n/top.txt\n")},
+		"top.txt":               {Data: []byte("top")},
+		"cover.psd":             {Data: []byte("psd")},
+		"keep.psd":              {Data: []byte("psd")},
+		"raw/photo.cr2":         {Data: []byte("raw")},
+		"trip/top.txt":          {Data: []byte("nested")},
+		"trip/notes.psd":        {Data: []byte("psd")},
+		"trip/.tgignore":        {Data: []byte("!notes.psd\n*.txt\n")},
+		"trip/day1/photo.jpg":   {Data: []byte("photo")},
+		"trip/day1/photo.png":   {Data: []byte("photo")},
+		"trip/day1/deep/a.jpg":  {Data: []byte("photo")},
+		"trip/day1/.hidden.jpg": {Data: []byte("photo")},
+	}
+	walk := func(filter *Filter) []string {
+		result := []string{}
+		err := filter.WalkDir(fsys, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				result = append(result, name)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(result)
+		return result
+	}
+
+	for _, test := range []struct {
+		name     string
+		filter   *Filter
+		expected []string
+	}{
+		{"default", nil, []string{
+			"big.mp4", "empty.txt", "keep.psd", "photo.jpg", "trip/day1/deep/a.jpg", "trip/day1/photo.jpg",
+			"trip/day1/photo.png", "trip/notes.psd",
+		}},
+		{"include", &Filter{Include: []string{"*.jpg", "/big.mp4"}}, []string{
+			"big.mp4", "photo.jpg", "trip/day1/deep/a.jpg", "trip/day1/photo.jpg",
+		}},
+		{"exclude", &Filter{Exclude: []string{"day1/", "keep.psd", "*.mp4"}}, []string{
+			"empty.txt", "photo.jpg", "trip/notes.psd",
+		}},
+		{"hidden", &Filter{Hidden: true, NoIgnoreFiles: true, MaxDepth: 1}, []string{
+			".DS_Store", "big.mp4", "cover.psd", "empty.txt", "keep.psd", "photo.jpg", "top.txt",
+		}},
+		{"depth", &Filter{MaxDepth: 3, Include: []string{"trip/**"}}, []string{
+			"trip/day1/photo.jpg", "trip/day1/photo.png", "trip/notes.psd",
+		}},
+		{"size", &Filter{MinSize: 1, MaxSize: 100, Include: []string{"*.mp4", "*.txt", "photo.*"}}, []string{
+			"photo.jpg", "trip/day1/photo.jpg", "trip/day1/photo.png",
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := walk(test.filter); !slices.Equal(actual, test.expected) {
+				t.Fatal("unexpected files", actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package tgdir
+
+import (
+	"context"
+	"fmt"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgcache"
+	"github.com/kittenbark/tgmedia/tgjournal"
+	"github.com/kittenbark/tgmedia/tgsend"
+	"github.com/kittenbark/tgmedia/tgsniff"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// SendFS is Send for the files of fsys (an embed.FS, a zip.Reader, ...).
+func SendFS(ctx context.Context, chatId int64, fsys fs.FS, opts ...*Opt) ([]*tg.Message, error) {
+	sender := &Sender{Photo: optsToPhoto(opts), Video: optsToVideo(opts), Document: optsToDocs(opts)}
+	report, err := sender.SendFS(ctx, chatId, fsys)
+	return report.Messages(), err
+}
+
+// SendGroupedFS is SendGrouped for the files of fsys.
+func SendGroupedFS(ctx context.Context, chatId int64, fsys fs.FS, opts ...*Opt) ([]*tg.Message, error) {
+	sender := &Sender{Grouped: true, Caption: optsToCaption(opts), Document: optsToDocs(opts), MediaGroup: optsToMediaGroup(opts)}
+	report, err := sender.SendFS(ctx, chatId, fsys)
+	return report.Messages(), err
+}
+
+// SendFS is Send for the files of fsys, reported by their paths in fsys. Uploads go from disk, so a file
+// is copied to a workspace right before it's sent and removed after; webm videos are piped to ffmpeg
+// without a copy. The files of an album that have a file id to reuse aren't copied at all, files sent by
+// themselves are copied all the same.
+func (s *Sender) SendFS(ctx context.Context, chatId int64, fsys fs.FS) (*Report, error) {
+	files, err := s.collectFS(fsys)
+	if err != nil {
+		return &Report{}, err
+	}
+	return s.send(ctx, chatId, files)
+}
+
+// PlanFS is Plan for the files of fsys.
+func (s *Sender) PlanFS(chatId int64, fsys fs.FS) ([]*Action, error) {
+	files, err := s.collectFS(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return s.plan(chatId, files), nil
+}
+
+// open opens the file, wherever it is.
+func (file *FileReport) open() (io.ReadCloser, error) {
+	if file.fsys == nil {
+		return os.Open(file.Path)
+	}
+	return file.fsys.Open(file.Path)
+}
+
+// Head is the start of the file content sniffing looks at, read once.
+func (file *FileReport) Head() []byte {
+	if file.head != nil {
+		return file.head
+	}
+	file.head = []byte{}
+	reader, err := file.open()
+	if err != nil {
+		return file.head
+	}
+	defer reader.Close()
+	if head, err := tgsniff.Head(reader); err == nil {
+		file.head = head
+	}
+	return file.head
+}
+
+// key is the file id key of the file, "" if file ids aren't reused.
+func (file *FileReport) key(ctx context.Context) (string, error) {
+	if file.fsys == nil || !tgsend.Reuses(ctx) {
+		return tgsend.Key(ctx, file.Path)
+	}
+	reader, err := file.open()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	return tgcache.HashReader(reader)
+}
+
+// local is the file on disk, spooled to a workspace removed by cleanup if it's in an FS.
+func (file *FileReport) local(ctx context.Context) (filename string, cleanup func(), err error) {
+	if file.fsys == nil {
+		return file.Path, func() {}, nil
+	}
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		return "", func() {}, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	filename, err = file.spool(ws)
+	if err != nil {
+		_ = ws.Close()
+		return "", func() {}, err
+	}
+	return filename, func() { _ = ws.Close() }, nil
+}
+
+// spool copies the file to ws under its own name (Telegram shows it for documents), a file on disk is
+// used in place.
+func (file *FileReport) spool(ws *tgtemp.Workspace) (string, error) {
+	if file.fsys == nil {
+		return file.Path, nil
+	}
+	dir, err := ws.Mkdir("spooled_*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary dir: %w", err)
+	}
+	reader, err := file.open()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	filename := filepath.Join(dir, path.Base(file.Path))
+	spooled, err := os.Create(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer spooled.Close()
+	if _, err := io.Copy(spooled, reader); err != nil {
+		return "", fmt.Errorf("failed to spool %s: %w", file.Path, err)
+	}
+	return filename, spooled.Close()
+}
+
+func (file *FileReport) delivered(journal *tgjournal.Journal, chatId int64) (*tgjournal.Entry, bool) {
+	if file.fsys == nil {
+		return journal.Delivered(chatId, file.Path, file.info)
+	}
+	return journal.DeliveredFS(chatId, file.fsys, file.Path, file.info)
+}
+
+func (file *FileReport) record(journal *tgjournal.Journal, chatId int64, messageIds []int64) error {
+	if file.fsys == nil {
+		return journal.Record(chatId, file.Path, file.info, messageIds)
+	}
+	return journal.RecordFS(chatId, file.fsys, file.Path, file.info, messageIds)
+}
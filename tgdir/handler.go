@@ -0,0 +1,160 @@
+package tgdir
+
+import (
+	"context"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgsend"
+	"github.com/kittenbark/tgmedia/tgsniff"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"github.com/kittenbark/tgmedia/tgvideo"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Handler sends the files it matches.
+type Handler struct {
+	// Name identifies the handler in plans and reports.
+	Name  string
+	Match Matcher
+	// Kind is how the files are sent, documents never go to albums.
+	Kind        Kind
+	Conversions []string
+
+	// Send sends a file by itself, filename is on disk. s has every option set.
+	Send func(ctx context.Context, s *Sender, chatId int64, filename string) (*tg.Message, error)
+	// Stream sends a file read from reader, name is its name. Optional, a file of an fs.FS is spooled to
+	// disk for Send without it.
+	Stream func(ctx context.Context, s *Sender, chatId int64, reader io.Reader, name string) (*tg.Message, error)
+	// Media is the album media of filename, ws is the album's workspace. Nil keeps the files out of albums.
+	Media func(ctx context.Context, ws *tgtemp.Workspace, filename string) (tg.InputMedia, error)
+	// Key is the file id key of the album media of filename, the content hash when nil.
+	Key func(filename string) (string, error)
+}
+
+// Matcher tells if a handler takes file, it's called before anything is sent.
+type Matcher func(file *FileReport) bool
+
+// Ext matches the files with any of the extensions (".jpg"), case-insensitively.
+func Ext(extensions ...string) Matcher {
+	return func(file *FileReport) bool {
+		ext := filepath.Ext(file.Path)
+		for _, extension := range extensions {
+			if strings.EqualFold(ext, extension) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MIME matches the files whose content is of any of the types, see tgsniff.Type. A type ending in "/"
+// matches every subtype ("image/").
+func MIME(types ...string) Matcher {
+	return func(file *FileReport) bool {
+		detected := tgsniff.Type(file.Path, file.Head())
+		for _, typ := range types {
+			if detected == typ || strings.HasSuffix(typ, "/") && strings.HasPrefix(detected, typ) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Any matches the files any of matchers matches.
+func Any(matchers ...Matcher) Matcher {
+	return func(file *FileReport) bool {
+		for _, match := range matchers {
+			if match(file) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Handlers are tried in order after Sender.Handlers, the first handler matching a file sends it. A file
+// no handler matches is sent by DocumentHandler.
+var Handlers = DefaultHandlers()
+
+// DefaultHandlers are the handlers of mp4/mov videos, webm videos (transcoded to H264) and png/jpeg
+// photos, told by their content (the extension only if it tells nothing).
+func DefaultHandlers() []*Handler {
+	return []*Handler{VideoHandler, H264Handler, PhotoHandler}
+}
+
+var (
+	VideoHandler = &Handler{
+		Name:  "video",
+		Match: MIME(tgsniff.MP4, tgsniff.QuickTime),
+		Kind:  KindVideo,
+		Send: func(ctx context.Context, s *Sender, chatId int64, filename string) (*tg.Message, error) {
+			return tgvideo.Send(ctx, chatId, filename, s.Video)
+		},
+		Media: func(ctx context.Context, ws *tgtemp.Workspace, filename string) (tg.InputMedia, error) {
+			return tgvideo.NewIn(ctx, ws, filename)
+		},
+	}
+	H264Handler = &Handler{
+		Name:        "h264",
+		Match:       MIME(tgsniff.WebM),
+		Kind:        KindVideo,
+		Conversions: []string{ConversionH264},
+		Send: func(ctx context.Context, s *Sender, chatId int64, filename string) (*tg.Message, error) {
+			return tgvideo.SendH264(ctx, chatId, filename, s.Video)
+		},
+		// ffmpeg reads from a pipe, the file is spooled only if its container needs seeking.
+		Stream: func(ctx context.Context, s *Sender, chatId int64, reader io.Reader, name string) (*tg.Message, error) {
+			return tgvideo.SendReaderTranscoded(ctx, chatId, reader, name, nil, s.Video)
+		},
+		Media: func(ctx context.Context, ws *tgtemp.Workspace, filename string) (tg.InputMedia, error) {
+			return tgvideo.NewTranscodedIn(ctx, ws, filename, nil)
+		},
+		Key: (*tgvideo.Profile)(nil).Key,
+	}
+	PhotoHandler = &Handler{
+		Name:  "photo",
+		Match: MIME("image/png", "image/jpeg"),
+		Kind:  KindPhoto,
+		Send: func(ctx context.Context, s *Sender, chatId int64, filename string) (*tg.Message, error) {
+			return tgsend.Photo(ctx, chatId, filename, s.Photo)
+		},
+		Media: func(ctx context.Context, ws *tgtemp.Workspace, filename string) (tg.InputMedia, error) {
+			return &tg.Photo{Media: tg.FromDisk(filename)}, nil
+		},
+	}
+	// DocumentHandler sends any file as a document, it takes the files no other handler does and the
+	// photos of Sender.PhotosAsDocs.
+	DocumentHandler = &Handler{
+		Name:  "document",
+		Match: func(file *FileReport) bool { return true },
+		Kind:  KindDocument,
+		Send: func(ctx context.Context, s *Sender, chatId int64, filename string) (*tg.Message, error) {
+			return tgsend.Document(ctx, chatId, filename, s.Document)
+		},
+	}
+)
+
+// handler picks the handler of file.
+func (s *Sender) handler(file *FileReport) *Handler {
+	for _, handlers := range [][]*Handler{s.Handlers, Handlers} {
+		for _, handler := range handlers {
+			if !handler.Match(file) {
+				continue
+			}
+			if s.PhotosAsDocs && handler.Kind == KindPhoto {
+				return DocumentHandler
+			}
+			return handler
+		}
+	}
+	return DocumentHandler
+}
+
+// withOptions is s with every option set, for handlers.
+func (s *Sender) withOptions() *Sender {
+	sender := *s
+	sender.Photo, sender.Video, sender.Document, sender.MediaGroup = s.photo(), s.video(), s.document(), s.mediaGroup()
+	return &sender
+}
@@ -0,0 +1,130 @@
+package tgdir
+
+import (
+	"bytes"
+	"context"
+	"github.com/kittenbark/tgmedia/tgexec"
+	"github.com/kittenbark/tgmedia/tgsniff"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"github.com/kittenbark/tgmedia/tgvideo"
+	"image"
+	"image/png"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHandlers(t *testing.T) {
+	t.Parallel()
+
+	picture := &bytes.Buffer{}
+	if err := png.Encode(picture, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"IMG_0001.JPG": {Data: []byte("jpeg")},
+		"IMG_0002":     {Data: []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00")},
+		"clip.MP4":     {Data: []byte("mp4")},
+		"song.mp3":     {Data: []byte("mp3")},
+		"export.jpeg":  {Data: picture.Bytes()},
+		"screenshot":   {Data: picture.Bytes()},
+		"notes.txt":    {Data: []byte("notes")},
+	}
+	audio := &Handler{Name: "audio", Match: Ext(".mp3"), Kind: KindDocument, Send: DocumentHandler.Send}
+	heic := &Handler{Name: "heic", Match: MIME(tgsniff.HEIC), Kind: KindDocument, Send: DocumentHandler.Send}
+
+	for _, test := range []struct {
+		sender   *Sender
+		expected map[string]*Handler
+	}{
+		{
+			sender: &Sender{},
+			expected: map[string]*Handler{
+				"IMG_0001.JPG": PhotoHandler,
+				"IMG_0002":     DocumentHandler,
+				"clip.MP4":     VideoHandler,
+				"song.mp3":     DocumentHandler,
+				"export.jpeg":  PhotoHandler,
+				"screenshot":   PhotoHandler,
+				"notes.txt":    DocumentHandler,
+			},
+		},
+		{
+			sender: &Sender{PhotosAsDocs: true, Handlers: []*Handler{audio, heic}},
+			expected: map[string]*Handler{
+				"IMG_0001.JPG": DocumentHandler,
+				"IMG_0002":     heic,
+				"clip.MP4":     VideoHandler,
+				"song.mp3":     audio,
+				"export.jpeg":  DocumentHandler,
+				"screenshot":   DocumentHandler,
+				"notes.txt":    DocumentHandler,
+			},
+		},
+	} {
+		files, err := test.sender.collectFS(fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			if file.Handler != test.expected[file.Path] {
+				t.Fatalf("%s: expected %s, got %s", file.Path, test.expected[file.Path].Name, file.Handler.Name)
+			}
+		}
+	}
+}
+
+// TestH264Handler isn't parallel: it swaps tgvideo's package-level Runner.
+func TestH264Handler(t *testing.T) {
+	recorder := &tgexec.Recorder{Respond: func(ctx context.Context, cmd *tgexec.Command) error {
+		if cmd.Name == tgvideo.Ffprobe {
+			_, err := io.WriteString(cmd.Stdout, `{"streams": [{"codec_type": "video", "width": 1280, "height": 720}], "format": {"duration": "3"}}`)
+			return err
+		}
+		return nil
+	}}
+	defer func(runner tgexec.Runner) { tgvideo.Runner = runner }(tgvideo.Runner)
+	tgvideo.Runner = recorder
+
+	fsys := fstest.MapFS{"clip.webm": {Data: []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm")}}
+	sender := &Sender{Grouped: true}
+	files, err := sender.Files(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[0].Handler != H264Handler {
+		t.Fatal("expected the webm transcoded", files[0].Handler.Name)
+	}
+
+	ctx := context.Background()
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	item, err := sender.item(ctx, ws, files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := item.New(); err != nil {
+		t.Fatal(err)
+	}
+
+	transcoded := false
+	for _, cmd := range recorder.Commands() {
+		if cmd.Name != tgvideo.Ffmpeg || !slices.Contains(cmd.Args, "libx264") {
+			continue
+		}
+		transcoded = true
+		input := cmd.Args[slices.Index(cmd.Args, "-i")+1]
+		if filepath.Base(input) != "clip.webm" || !strings.HasPrefix(input, ws.Dir()) {
+			t.Fatal("expected the spooled webm transcoded", cmd.Args)
+		}
+	}
+	if !transcoded {
+		t.Fatal("no transcoding command", recorder.Commands())
+	}
+}
@@ -0,0 +1,84 @@
+//go:build linux
+
+package tgdir
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const notifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_MOVED_TO |
+	syscall.IN_MOVED_FROM | syscall.IN_DELETE | syscall.IN_ATTRIB
+
+// notify signals changes in dir and its subdirectories with inotify, until ctx is done.
+func notify(ctx context.Context, dir string) (<-chan struct{}, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	// a non-blocking fd goes through the runtime poller, closing the file interrupts a pending read.
+	file := os.NewFile(uintptr(fd), "inotify")
+
+	dirs := map[int32]string{}
+	add := func(root string) error {
+		return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			wd, err := syscall.InotifyAddWatch(fd, path, notifyMask)
+			if err != nil {
+				return err
+			}
+			dirs[int32(wd)] = path
+			return nil
+		})
+	}
+	if err := add(dir); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	stop := context.AfterFunc(ctx, func() { _ = file.Close() })
+	go func() {
+		defer stop()
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				_ = file.Close()
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+				offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+				if event.Mask&syscall.IN_ISDIR != 0 && event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+					if parent, ok := dirs[event.Wd]; ok {
+						_ = add(filepath.Join(parent, cString(nameBytes)))
+					}
+				}
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// cString is the string of a NUL padded name.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package tgdir
+
+import (
+	"context"
+	"errors"
+)
+
+// notify isn't available off linux, Watch polls.
+func notify(ctx context.Context, dir string) (<-chan struct{}, error) {
+	return nil, errors.New("tgdir: inotify is linux only")
+}
@@ -0,0 +1,180 @@
+package tgdir
+
+import (
+	"cmp"
+	"context"
+	"github.com/kittenbark/tgmedia/tgphoto"
+	"github.com/kittenbark/tgmedia/tgvideo"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Order compares two files of the same directory, negative if a is sent first. Any function will do,
+// ties go by OrderNatural.
+type Order func(a, b *FileReport) int
+
+var (
+	// OrderLexical sorts by name, byte by byte: "img10.jpg" goes before "img2.jpg".
+	OrderLexical Order = func(a, b *FileReport) int {
+		return strings.Compare(path.Base(a.rel), path.Base(b.rel))
+	}
+	// OrderNatural sorts by name with the numbers in it compared by value: "img2.jpg" goes before "img10.jpg".
+	OrderNatural Order = func(a, b *FileReport) int {
+		return natural(path.Base(a.rel), path.Base(b.rel))
+	}
+	// OrderModTime sorts by modification time, oldest first.
+	OrderModTime Order = func(a, b *FileReport) int {
+		return a.info.ModTime().Compare(b.info.ModTime())
+	}
+	// OrderDate sorts by when photos were taken (EXIF) and videos recorded (the container's creation time),
+	// oldest first. The modification time stands in for the files without a date.
+	OrderDate Order = func(a, b *FileReport) int {
+		return a.date().Compare(b.date())
+	}
+	// OrderSize sorts by size, smallest first.
+	OrderSize Order = func(a, b *FileReport) int {
+		return cmp.Compare(a.Bytes, b.Bytes)
+	}
+)
+
+// Reversed is order the other way around, e.g. Reversed(OrderDate) sends the newest files first.
+func Reversed(order Order) Order {
+	return func(a, b *FileReport) int { return order(b, a) }
+}
+
+// Subdirs is how the subdirectories of the directory sent are gone through.
+type Subdirs int
+
+const (
+	// SubdirsDepthFirst sends the files of a directory, then each of its subdirectories in turn, albums
+	// take the files of consecutive directories.
+	SubdirsDepthFirst Subdirs = iota
+	// SubdirsGrouped is SubdirsDepthFirst with every directory sent as a group of its own: albums (and the
+	// archives of tgarchive) don't take files of two directories.
+	SubdirsGrouped
+)
+
+// arrange puts files in the order they're sent, they're left in the order of the walk when it's the one.
+func arrange(files []*FileReport, order Order, subdirs Subdirs) {
+	if order != nil || subdirs != SubdirsDepthFirst || slices.ContainsFunc(files, ordered) {
+		sortFiles(files, order)
+	}
+}
+
+// sortFiles puts files in the order they're sent: directory by directory (see Subdirs), each one's files
+// by the order of its Settings, order or OrderLexical.
+func sortFiles(files []*FileReport, order Order) {
+	slices.SortStableFunc(files, func(a, b *FileReport) int {
+		if c := compareDirs(path.Dir(a.rel), path.Dir(b.rel)); c != 0 {
+			return c
+		}
+		order := order
+		switch {
+		case ordered(a):
+			order = a.Settings.order
+		case order == nil:
+			order = OrderLexical
+		}
+		if c := order(a, b); c != 0 {
+			return c
+		}
+		return OrderNatural(a, b)
+	})
+}
+
+// ordered tells whether the settings of file's directory have an order.
+func ordered(file *FileReport) bool {
+	return file.Settings != nil && file.Settings.order != nil
+}
+
+// compareDirs orders directories depth-first: a directory goes before its subdirectories, which go by
+// their names, naturally.
+func compareDirs(a, b string) int {
+	if a == b {
+		return 0
+	}
+	segments := func(dir string) []string {
+		if dir == "." {
+			return nil
+		}
+		return strings.Split(dir, "/")
+	}
+	as, bs := segments(a), segments(b)
+	for i := range min(len(as), len(bs)) {
+		if c := natural(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(as), len(bs))
+}
+
+// natural compares a and b with their runs of digits compared by value, the names equal by value go
+// byte by byte ("img01" before "img1").
+func natural(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if !isDigit(a[i]) || !isDigit(b[j]) {
+			if a[i] != b[j] {
+				return cmp.Compare(a[i], b[j])
+			}
+			i, j = i+1, j+1
+			continue
+		}
+		startA, startB := i, j
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		numA, numB := strings.TrimLeft(a[startA:i], "0"), strings.TrimLeft(b[startB:j], "0")
+		if c := cmp.Compare(len(numA), len(numB)); c != 0 {
+			return c
+		}
+		if c := strings.Compare(numA, numB); c != 0 {
+			return c
+		}
+	}
+	if c := cmp.Compare(len(a)-i, len(b)-j); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// date is when the file was taken or recorded, its modification time if that's unknown.
+func (file *FileReport) date() time.Time {
+	if taken, ok := file.taken(); ok {
+		return taken
+	}
+	return file.info.ModTime()
+}
+
+// taken is when a photo was taken (EXIF) or a video recorded (its container's creation time, files on
+// disk only), read once. ok is false if it's unknown.
+func (file *FileReport) taken() (time.Time, bool) {
+	if file.dated {
+		return file.takenAt, !file.takenAt.IsZero()
+	}
+	file.dated = true
+	switch file.Kind {
+	case KindVideo:
+		if file.fsys != nil {
+			break
+		}
+		if meta, err := tgvideo.Probe(context.Background(), file.Path); err == nil {
+			file.takenAt = meta.CreationTime
+		}
+	default:
+		if reader, err := file.open(); err == nil {
+			file.takenAt, _ = tgphoto.Taken(reader)
+			_ = reader.Close()
+		}
+	}
+	return file.takenAt, !file.takenAt.IsZero()
+}
@@ -0,0 +1,81 @@
+package tgdir
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestOrder(t *testing.T) {
+	t.Parallel()
+
+	buffer := &bytes.Buffer{}
+	if err := png.Encode(buffer, image.NewGray(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	photo := buffer.Bytes()
+	now := time.Now()
+	fsys := fstest.MapFS{
+		"img10.png":        {Data: photo, ModTime: now.Add(-3 * time.Hour)},
+		"img2.png":         {Data: photo, ModTime: now.Add(-1 * time.Hour)},
+		"img1.png":         {Data: photo, ModTime: now.Add(-2 * time.Hour)},
+		"notes.txt":        {Data: []byte("notes, the biggest one"), ModTime: now},
+		"trip/day2/a.png":  {Data: photo, ModTime: now},
+		"trip/day10/a.png": {Data: photo, ModTime: now},
+		"trip/b.png":       {Data: photo, ModTime: now},
+	}
+	paths := func(files []*FileReport) []string {
+		result := []string{}
+		for _, file := range files {
+			result = append(result, file.Path)
+		}
+		return result
+	}
+
+	for _, test := range []struct {
+		name     string
+		order    Order
+		expected []string
+	}{
+		{"walk", nil, []string{"img1.png", "img10.png", "img2.png", "notes.txt", "trip/b.png", "trip/day10/a.png", "trip/day2/a.png"}},
+		{"natural", OrderNatural, []string{"img1.png", "img2.png", "img10.png", "notes.txt", "trip/b.png", "trip/day2/a.png", "trip/day10/a.png"}},
+		{"mtime", OrderModTime, []string{"img10.png", "img1.png", "img2.png", "notes.txt", "trip/b.png", "trip/day2/a.png", "trip/day10/a.png"}},
+		{"date", Reversed(OrderDate), []string{"notes.txt", "img2.png", "img1.png", "img10.png", "trip/b.png", "trip/day2/a.png", "trip/day10/a.png"}},
+		{"size", Reversed(OrderSize), []string{"img1.png", "img2.png", "img10.png", "notes.txt", "trip/b.png", "trip/day2/a.png", "trip/day10/a.png"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			files, err := (&Sender{Order: test.order}).Files(fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := paths(files); !slices.Equal(actual, test.expected) {
+				t.Fatal("unexpected order", actual)
+			}
+			walked, err := (*Filter)(nil).Walk(fsys, test.order, SubdirsDepthFirst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := paths(walked); !slices.Equal(actual, test.expected) || walked[0].Handler != nil {
+				t.Fatal("expected the walk in the same order, without handlers", actual)
+			}
+		})
+	}
+
+	t.Run("grouped", func(t *testing.T) {
+		actions, err := (&Sender{Grouped: true, Order: OrderNatural, Subdirs: SubdirsGrouped}).PlanFS(0, fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types := []ActionType{}
+		for _, action := range actions {
+			types = append(types, action.Type)
+		}
+		if !slices.Equal(types, []ActionType{ActionAlbum, ActionSend, ActionSend, ActionSend, ActionSend}) {
+			t.Fatal("expected an album of the top directory and a send per subdirectory", actions)
+		}
+	})
+}
@@ -0,0 +1,251 @@
+package tgdir
+
+import (
+	"context"
+	"fmt"
+	"github.com/kittenbark/tgmedia/tgsend"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"path"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Telegram's limits for bots, see https://core.telegram.org/bots/api.
+const (
+	// photoSizeLimit is the largest photo a bot uploads.
+	photoSizeLimit = 10 << 20
+	// photoSidesLimit is the most the width and height of a photo add up to.
+	photoSidesLimit = 10_000
+	// photoRatioLimit is the most the sides of a photo differ.
+	photoRatioLimit = 20
+	// uploadLimit is the largest video or document a bot uploads.
+	uploadLimit = 50 << 20
+	// captionLimit is the most characters a caption takes.
+	captionLimit = tgsend.CaptionLimit
+)
+
+// ActionType is what an action does.
+type ActionType string
+
+const (
+	// ActionSend sends a file by itself, with its Handler.
+	ActionSend ActionType = "send"
+	// ActionAlbum sends photos and videos as one album.
+	ActionAlbum ActionType = "album"
+	// ActionSkip leaves files out, see Action.Reason.
+	ActionSkip ActionType = "skip"
+)
+
+// Action is a step of a plan, Sender.Execute does them in order. A plan may be edited before executing:
+// actions removed or reordered, a file's Handler changed, albums split.
+type Action struct {
+	Type  ActionType
+	Files []*FileReport
+	// Reason is why the files are skipped.
+	Reason string
+	// Warnings are the limits of Telegram the action is expected to break, it's attempted anyway.
+	Warnings []string
+}
+
+// String is a line describing the action, e.g. for printing plans.
+func (a *Action) String() string {
+	files := []string{}
+	for _, file := range a.Files {
+		desc := string(file.Kind)
+		if file.Handler != nil && file.Handler.Name != string(file.Kind) {
+			desc = file.Handler.Name
+		}
+		if len(file.Conversions) > 0 {
+			desc += "+" + strings.Join(file.Conversions, "+")
+		}
+		files = append(files, fmt.Sprintf("%s (%s)", file.Path, desc))
+	}
+	result := fmt.Sprintf("%s %s", a.Type, strings.Join(files, ", "))
+	if a.Reason != "" {
+		result += ": " + a.Reason
+	}
+	for _, warning := range a.Warnings {
+		result += "; warning: " + warning
+	}
+	return result
+}
+
+// Plan is what Send would do with dir, see Sender.Plan.
+func Plan(dir string, opts ...*Opt) ([]*Action, error) {
+	sender := &Sender{Photo: optsToPhoto(opts), Video: optsToVideo(opts), Document: optsToDocs(opts)}
+	return sender.Plan(0, dir)
+}
+
+// PlanGrouped is what SendGrouped would do with dir, see Sender.Plan.
+func PlanGrouped(dir string, opts ...*Opt) ([]*Action, error) {
+	sender := &Sender{Grouped: true, Caption: optsToCaption(opts), Document: optsToDocs(opts), MediaGroup: optsToMediaGroup(opts)}
+	return sender.Plan(0, dir)
+}
+
+// Plan lists what Send would do with dir, without sending or converting anything. chatId only matters
+// with a Journal: the files it has for the chat are skipped.
+func (s *Sender) Plan(chatId int64, dir string) ([]*Action, error) {
+	files, err := s.collect(dir)
+	if err != nil {
+		return nil, err
+	}
+	return s.plan(chatId, files), nil
+}
+
+// plan splits files into actions: albums of up to albumLimit photos and videos with Grouped, single
+// sends otherwise. A lone file of an album is sent by itself, albums take two files at least. A file
+// sent by itself ends the album before it, and with SubdirsGrouped, albums end with their directory.
+func (s *Sender) plan(chatId int64, files []*FileReport) []*Action {
+	actions := []*Action{}
+	album := []*FileReport{}
+	dir := ""
+	flush := func() {
+		switch len(album) {
+		case 0:
+		case 1:
+			actions = append(actions, s.action(ActionSend, album...))
+		default:
+			actions = append(actions, s.action(ActionAlbum, album...))
+		}
+		album = []*FileReport{}
+	}
+	for _, file := range files {
+		if entry, ok := file.delivered(s.Journal, chatId); ok {
+			file.Journaled = entry
+			actions = append(actions, &Action{Type: ActionSkip, Files: []*FileReport{file}, Reason: "delivered before"})
+			continue
+		}
+		if s.Subdirs == SubdirsGrouped && path.Dir(file.rel) != dir {
+			flush()
+			dir = path.Dir(file.rel)
+		}
+		if file.Settings.grouped(s.Grouped) && file.Kind != KindDocument && file.Handler.Media != nil {
+			album = append(album, file)
+			if len(album) == albumLimit {
+				flush()
+			}
+			continue
+		}
+		// the album so far goes first, the files are sent in order.
+		flush()
+		actions = append(actions, s.action(ActionSend, file))
+	}
+	flush()
+	return actions
+}
+
+// action is an action of files with the limits it breaks.
+func (s *Sender) action(typ ActionType, files ...*FileReport) *Action {
+	action := &Action{Type: typ, Files: files}
+	for _, file := range files {
+		action.Warnings = append(action.Warnings, s.violations(file, typ == ActionSend)...)
+	}
+	return action
+}
+
+// violations are the limits file is expected to break, caption tells if it's sent with the caption.
+func (s *Sender) violations(file *FileReport, caption bool) []string {
+	result := []string{}
+	if file.Bytes == 0 {
+		result = append(result, fmt.Sprintf("%s is empty", file.Path))
+	}
+
+	switch {
+	case file.Kind == KindPhoto:
+		if file.Bytes > photoSizeLimit {
+			result = append(result, fmt.Sprintf("photo %s is %d bytes, over %d", file.Path, file.Bytes, photoSizeLimit))
+		}
+		if width, height, ok := dimensions(file); ok {
+			if width+height > photoSidesLimit {
+				result = append(result, fmt.Sprintf("photo %s is %dx%d, sides over %d", file.Path, width, height, photoSidesLimit))
+			}
+			if max(width, height) > photoRatioLimit*min(width, height) {
+				result = append(result, fmt.Sprintf("photo %s is %dx%d, ratio over %d", file.Path, width, height, photoRatioLimit))
+			}
+		}
+	case file.Kind == KindVideo && slices.Contains(file.Conversions, ConversionH264):
+		// the size is known after transcoding.
+	default:
+		if file.Bytes > uploadLimit {
+			result = append(result, fmt.Sprintf("%s %s is %d bytes, over %d", file.Kind, file.Path, file.Bytes, uploadLimit))
+		}
+	}
+
+	if caption && s.Caption == nil && !file.Settings.hasCaption() {
+		text := ""
+		switch file.Kind {
+		case KindPhoto:
+			text = s.photo().Caption
+		case KindVideo:
+			text = s.video().Caption
+		default:
+			text = s.document().Caption
+		}
+		if n := utf8.RuneCountInString(text); n > captionLimit {
+			result = append(result, fmt.Sprintf("caption of %s is %d characters, over %d", file.Path, n, captionLimit))
+		}
+	}
+	return result
+}
+
+// dimensions reads the size of an image from its header, ok is false if it's not a jpeg or png.
+func dimensions(file *FileReport) (width int, height int, ok bool) {
+	reader, err := file.open()
+	if err != nil {
+		return 0, 0, false
+	}
+	defer reader.Close()
+	config, _, err := image.DecodeConfig(reader)
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return 0, 0, false
+	}
+	return config.Width, config.Height, true
+}
+
+// Execute does the actions of plan in order and reports on their files, the files of plan are filled in
+// along the way. Errors are handled as in Send.
+func (s *Sender) Execute(ctx context.Context, chatId int64, plan []*Action) (*Report, error) {
+	report := &Report{}
+	total, index, albums := 0, 0, 0
+	for _, action := range plan {
+		if action.Type != ActionSkip {
+			total += len(action.Files)
+		}
+	}
+	for _, action := range plan {
+		report.Files = append(report.Files, action.Files...)
+		for _, file := range action.Files {
+			// the handler may have been changed in the plan.
+			file.Kind, file.Conversions = file.Handler.Kind, file.Handler.Conversions
+		}
+		var err error
+		switch action.Type {
+		case ActionSkip:
+			continue
+		case ActionAlbum:
+			albums++
+			caption := s.captionData(ctx, action.Files[0], index+1, total, albums)
+			index += len(action.Files)
+			err = s.sendAlbum(ctx, chatId, action.Files, caption)
+		case ActionSend:
+			for _, file := range action.Files {
+				index++
+				if err = s.sendFile(ctx, chatId, file, s.captionData(ctx, file, index, total, 0)); err != nil && !s.ContinueOnError {
+					break
+				}
+			}
+		default:
+			return report, fmt.Errorf("unknown action %q", action.Type)
+		}
+		if journalErr := s.record(chatId, action.Files...); journalErr != nil {
+			return report, journalErr
+		}
+		if err != nil && !s.ContinueOnError {
+			return report, err
+		}
+	}
+	return report, report.Err()
+}
@@ -0,0 +1,157 @@
+package tgdir
+
+import (
+	"context"
+	"fmt"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	photo := func(name string, width, height int) {
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if err := png.Encode(file, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 11 {
+		photo(fmt.Sprintf("photo_%02d.png", i), 16, 16)
+	}
+	photo("photo_99_wide.png", 420, 20)
+	write("notes.txt", []byte("notes"))
+	write("video.webm", []byte("webm"))
+	write("empty.mp4", nil)
+
+	t.Run("single", func(t *testing.T) {
+		actions, err := Plan(dir, &Opt{Caption: strings.Repeat("x", captionLimit+1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actions) != 15 {
+			t.Fatal("expected a send per file", actions)
+		}
+		for _, action := range actions {
+			if action.Type != ActionSend || len(action.Files) != 1 || len(action.Warnings) == 0 {
+				t.Fatal("expected a send over the caption limit", action)
+			}
+		}
+	})
+
+	t.Run("grouped", func(t *testing.T) {
+		actions, err := PlanGrouped(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		summary := []string{}
+		for _, action := range actions {
+			summary = append(summary, fmt.Sprintf("%s:%d:%d", action.Type, len(action.Files), len(action.Warnings)))
+		}
+		// notes.txt ends the album of empty.mp4, which is sent by itself before it.
+		expected := []string{"send:1:1", "send:1:0", "album:10:0", "album:3:1"}
+		if !slices.Equal(summary, expected) {
+			t.Fatal("unexpected plan", summary, actions)
+		}
+		last := actions[3].Files
+		if last[2].Kind != KindVideo || !slices.Contains(last[2].Conversions, ConversionH264) {
+			t.Fatal("expected webm transcoded", last[2])
+		}
+		if !strings.Contains(actions[3].Warnings[0], "ratio") {
+			t.Fatal("expected the wide photo flagged", actions[3].Warnings)
+		}
+	})
+}
+
+func TestPlanFS(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"a/photo.jpg": {Data: []byte("photo")},
+		"a/clip.webm": {Data: []byte("webm")},
+		"notes.txt":   {Data: []byte("notes")},
+	}
+	actions, err := (&Sender{Grouped: true}).PlanFS(0, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || actions[0].Type != ActionAlbum || actions[1].Type != ActionSend {
+		t.Fatal("expected an album and a document", actions)
+	}
+	if paths := []string{actions[0].Files[0].Path, actions[0].Files[1].Path}; !slices.Equal(paths, []string{"a/clip.webm", "a/photo.jpg"}) {
+		t.Fatal("expected paths in the FS", paths)
+	}
+
+	ws, err := tgtemp.New(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	notes := actions[1].Files[0]
+	spooled, err := notes.spool(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(spooled); err != nil || string(data) != "notes" || filepath.Base(spooled) != "notes.txt" {
+		t.Fatal("expected notes.txt spooled under its name", spooled, string(data), err)
+	}
+}
+
+func TestExecute_AlbumFailure(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"bad_1.png": {Data: []byte("photo")},
+		"bad_2.png": {Data: []byte("photo")},
+		"good.png":  {Data: []byte("photo")},
+	}
+	sent := []string{}
+	handler := &Handler{
+		Name:  "fake",
+		Match: Ext(".png"),
+		Kind:  KindPhoto,
+		Send: func(ctx context.Context, s *Sender, chatId int64, filename string) (*tg.Message, error) {
+			sent = append(sent, filepath.Base(filename))
+			return &tg.Message{MessageId: int64(len(sent))}, nil
+		},
+		Media: func(ctx context.Context, ws *tgtemp.Workspace, filename string) (tg.InputMedia, error) {
+			return nil, fmt.Errorf("broken %s", filepath.Base(filename))
+		},
+	}
+	sender := &Sender{Grouped: true, ContinueOnError: true, Handlers: []*Handler{handler}}
+	report, err := sender.SendFS(context.Background(), 0, fsys)
+	if err == nil {
+		t.Fatal("expected the broken files reported")
+	}
+	// bad_1 and bad_2 break the album in turn, good is left alone and goes by itself.
+	for _, file := range report.Files {
+		broken := strings.HasPrefix(file.Path, "bad")
+		if broken != (file.Err != nil) || broken == (len(file.Messages) == 1) {
+			t.Fatal("expected the errors on the broken files only", file.Path, file.Err, file.Messages)
+		}
+		if file.Err != nil && !strings.Contains(file.Err.Error(), file.Path) {
+			t.Fatal("expected the file's own error", file.Path, file.Err)
+		}
+	}
+	if !slices.Equal(sent, []string{"good.png"}) {
+		t.Fatal("expected good.png sent by itself", sent)
+	}
+}
@@ -0,0 +1,96 @@
+package tgdir
+
+import (
+	"errors"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgjournal"
+	"io/fs"
+	"time"
+)
+
+// Kind is how a file is sent.
+type Kind string
+
+const (
+	KindPhoto    Kind = "photo"
+	KindVideo    Kind = "video"
+	KindDocument Kind = "document"
+)
+
+// Conversions a file may go through before sending.
+const (
+	// ConversionH264 is transcoding a video Telegram can't play (e.g. webm) to H264.
+	ConversionH264 = "h264"
+)
+
+// Report tells what happened to every file of a directory, in the order they were sent.
+type Report struct {
+	Files []*FileReport
+}
+
+// FileReport is what happened to a file.
+type FileReport struct {
+	// Path is the file's path, dir joined with its path in dir. Sent from an fs.FS, it's the path in the FS.
+	Path        string
+	Kind        Kind
+	Conversions []string
+	// Handler sends the file, Kind and Conversions are its.
+	Handler *Handler
+	// Settings are read from the sidecars of the file and its directories, nil without any.
+	Settings *Settings
+	// Messages are the messages of the file, an album has one per file.
+	Messages []*tg.Message
+	Err      error
+	// Bytes is the size of the file before conversions.
+	Bytes int64
+	// Duration is the time spent converting and sending the file, for albums the upload of the whole album.
+	Duration time.Duration
+	// Journaled is the journal entry of a file delivered by a previous run (see Sender.Journal), it wasn't
+	// sent again and has no Messages.
+	Journaled *tgjournal.Entry
+
+	info fs.FileInfo
+	// fsys is the FS the file is in, nil for files on disk.
+	fsys fs.FS
+	// rel is the slash-separated path of the file in the directory (or FS) sent.
+	rel  string
+	head []byte
+	// takenAt is when the file was taken or recorded, dated tells it was read.
+	takenAt time.Time
+	dated   bool
+}
+
+// Messages returns the messages of every file in order, a nil report has none.
+func (r *Report) Messages() []*tg.Message {
+	result := []*tg.Message{}
+	if r == nil {
+		return result
+	}
+	for _, file := range r.Files {
+		result = append(result, file.Messages...)
+	}
+	return result
+}
+
+// Failed returns the files that didn't go through.
+func (r *Report) Failed() []*FileReport {
+	result := []*FileReport{}
+	if r == nil {
+		return result
+	}
+	for _, file := range r.Files {
+		if file.Err != nil {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
+// Err joins the errors of the failed files, nil if every file went through.
+func (r *Report) Err() error {
+	errs := []error{}
+	for _, file := range r.Failed() {
+		errs = append(errs, file.Err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,382 @@
+package tgdir
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgcache"
+	"github.com/kittenbark/tgmedia/tgjournal"
+	"github.com/kittenbark/tgmedia/tgsend"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// albumLimit is the most media an album takes.
+const albumLimit = 10
+
+// Sender sends directories, its zero value sends like Send.
+type Sender struct {
+	// PhotosAsDocs sends pictures as documents, like SendDocs.
+	PhotosAsDocs bool
+	// Grouped sends pictures and videos as albums, like SendGrouped.
+	Grouped bool
+	// ContinueOnError keeps sending the other files when one fails, the failures are in the report.
+	ContinueOnError bool
+	// Journal records the delivered files, the files it has for the chat are skipped. Sending the same
+	// directory again with the same journal resumes where an interrupted run stopped.
+	Journal *tgjournal.Journal
+	// Caption replaces the captions of the options with one built for every file, albums have it on
+	// their first item.
+	Caption *Caption
+	// Handlers are tried before the package-level Handlers, to add or override handlers for this sender.
+	Handlers []*Handler
+	// Order is the order of the files of every directory, lexical by default. Set (or with SubdirsGrouped),
+	// a directory's files go before its subdirectories, the walk order mixes them otherwise.
+	Order Order
+	// Subdirs is how subdirectories are gone through, depth-first by default.
+	Subdirs Subdirs
+	// Filter picks the files to send, nil leaves out the hidden files, Excluded and what .tgignore files
+	// list.
+	Filter *Filter
+	// NoSidecars sends the sidecars (see Settings) as files, instead of reading them.
+	NoSidecars bool
+
+	Photo      *tg.OptSendPhoto
+	Video      *tg.OptSendVideo
+	Document   *tg.OptSendDocument
+	MediaGroup *tg.OptSendMediaGroup
+}
+
+// Send sends the files of dir (recursively, see Filter, Order and Subdirs), it executes the Plan of dir.
+// The report is never nil: without ContinueOnError it ends with the failed file, and the error is that
+// file's; with it, every file is there and the error joins the failures. Failing to write the journal
+// stops sending in any case.
+func (s *Sender) Send(ctx context.Context, chatId int64, dir string) (*Report, error) {
+	files, err := s.collect(dir)
+	if err != nil {
+		return &Report{}, err
+	}
+	return s.send(ctx, chatId, files)
+}
+
+// send sends the collected files, see Send.
+func (s *Sender) send(ctx context.Context, chatId int64, files []*FileReport) (*Report, error) {
+	return s.Execute(ctx, chatId, s.plan(chatId, files))
+}
+
+// record journals the delivered files.
+func (s *Sender) record(chatId int64, files ...*FileReport) error {
+	for _, file := range files {
+		if file.Err != nil || len(file.Messages) == 0 {
+			continue
+		}
+		ids := []int64{}
+		for _, msg := range file.Messages {
+			ids = append(ids, msg.MessageId)
+		}
+		if err := file.record(s.Journal, chatId, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collect walks dir and decides how to send each file.
+func (s *Sender) collect(dir string) ([]*FileReport, error) {
+	return s.collectIn(os.DirFS(dir), dir)
+}
+
+// collectFS walks fsys and decides how to send each file.
+func (s *Sender) collectFS(fsys fs.FS) ([]*FileReport, error) {
+	return s.collectIn(fsys, "")
+}
+
+// collectIn walks fsys and decides how to send each file, dir is where fsys is on disk ("" if it isn't).
+func (s *Sender) collectIn(fsys fs.FS, dir string) ([]*FileReport, error) {
+	result, err := s.Filter.files(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	if !s.NoSidecars {
+		if result, err = s.sidecars(fsys, result); err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range result {
+		s.pick(file)
+	}
+	arrange(result, s.Order, s.Subdirs)
+	return result, nil
+}
+
+// Files lists the files of fsys in the order they're sent, with the handlers sending them.
+func (s *Sender) Files(fsys fs.FS) ([]*FileReport, error) {
+	return s.collectFS(fsys)
+}
+
+// file is the report of filename before sending, fsys is the FS it's in (nil for files on disk).
+func (s *Sender) file(filename string, info fs.FileInfo, fsys fs.FS) *FileReport {
+	file := newFile(filename, info, fsys)
+	s.pick(file)
+	return file
+}
+
+// newFile is the report of filename with no handler picked yet, fsys is the FS it's in (nil for files
+// on disk).
+func newFile(filename string, info fs.FileInfo, fsys fs.FS) *FileReport {
+	return &FileReport{Path: filename, Bytes: info.Size(), info: info, fsys: fsys, rel: filepath.ToSlash(filename)}
+}
+
+// pick sets the handler sending file.
+func (s *Sender) pick(file *FileReport) {
+	file.Handler = s.handler(file)
+	file.Kind, file.Conversions = file.Handler.Kind, file.Handler.Conversions
+}
+
+func (s *Sender) sendFile(ctx context.Context, chatId int64, file *FileReport, caption *CaptionData) error {
+	start := time.Now()
+	defer func() { file.Duration = time.Since(start) }()
+
+	msg, err := s.sendMedia(ctx, chatId, file, caption)
+	if err != nil {
+		file.Err = fmt.Errorf("send %s %s: %w", file.Kind, file.Path, err)
+		return file.Err
+	}
+	file.Messages = []*tg.Message{msg}
+	return nil
+}
+
+func (s *Sender) sendMedia(ctx context.Context, chatId int64, file *FileReport, caption *CaptionData) (*tg.Message, error) {
+	handler := file.Handler
+	if file.Settings.hasCaption() {
+		// the sidecar caption replaces the template's.
+		caption = nil
+	}
+	if handler.Stream != nil && file.fsys != nil && caption == nil {
+		reader, err := file.open()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return handler.Stream(ctx, s.withOptions().withSettings(file.Settings), chatId, reader, path.Base(file.Path))
+	}
+
+	filename, cleanup, err := file.local(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	sender := s.withOptions()
+	if caption != nil {
+		caption.filename = filename
+		text, err := s.Caption.Execute(caption)
+		if err != nil {
+			return nil, err
+		}
+		sender = sender.withCaption(text)
+	}
+	return handler.Send(ctx, sender.withSettings(file.Settings), chatId, filename)
+}
+
+// sendAlbum sends album, the files spooled or transcoded for it are removed once it's sent. The caption
+// goes on the first item, the sidecar captions on their own. With ContinueOnError, a file failing to build
+// is left out and the others are sent without it, and an album Telegram rejects is sent file by file: the
+// errors are on the files that didn't go through only.
+func (s *Sender) sendAlbum(ctx context.Context, chatId int64, album []*FileReport, caption *CaptionData) error {
+	start := time.Now()
+	defer func() {
+		for _, file := range album {
+			file.Duration = time.Since(start)
+		}
+	}()
+
+	err := s.trySendAlbum(ctx, chatId, album, caption)
+	if err == nil {
+		return nil
+	}
+	if !s.ContinueOnError {
+		return s.failAlbum(album, err)
+	}
+	rest := []*FileReport{}
+	for _, file := range album {
+		if file.Err == nil {
+			rest = append(rest, file)
+		}
+	}
+	if len(rest) == 0 {
+		return err
+	}
+	caption = caption.moved(rest[0], slices.Index(album, rest[0]))
+	if len(rest) > 1 && len(rest) < len(album) {
+		return errors.Join(err, s.sendAlbum(ctx, chatId, rest, caption))
+	}
+
+	// none of the files is to blame (or one is left), they go by themselves.
+	errs := []error{}
+	if len(rest) < len(album) {
+		errs = append(errs, err)
+	}
+	for i, file := range rest {
+		if i > 0 {
+			caption = nil
+		}
+		errs = append(errs, s.sendFile(ctx, chatId, file, caption))
+	}
+	return errors.Join(errs...)
+}
+
+// trySendAlbum sends album once, the errors of the files to blame are on them.
+func (s *Sender) trySendAlbum(ctx context.Context, chatId int64, album []*FileReport, caption *CaptionData) error {
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create workspace: %w", err)
+	}
+	defer ws.Close()
+
+	items := []*tgsend.Item{}
+	opt := *s.mediaGroup()
+	for _, file := range album {
+		item, err := s.item(ctx, ws, file)
+		if err != nil {
+			file.Err = err
+			return err
+		}
+		if settings := file.Settings; settings != nil {
+			parseMode := ""
+			if s.Caption != nil {
+				parseMode = s.Caption.parseMode
+			}
+			item.Caption, item.ParseMode, _ = settings.caption(parseMode)
+			item.Spoiler = settings.Spoiler != nil && *settings.Spoiler
+		}
+		items = append(items, item)
+	}
+	if caption != nil && !album[0].Settings.hasCaption() {
+		caption.ws = ws
+		text, err := s.Caption.Execute(caption)
+		caption.ws = nil
+		if err != nil {
+			return err
+		}
+		items[0].Caption, items[0].ParseMode = text, s.Caption.parseMode
+	}
+
+	opt.ProtectContent = protected(album, opt.ProtectContent)
+	messages, err := tgsend.MediaGroup(ctx, chatId, items, &opt)
+	if err != nil {
+		return fmt.Errorf("send album: %w", err)
+	}
+	for i, file := range album {
+		if i < len(messages) {
+			file.Messages = []*tg.Message{messages[i]}
+		}
+	}
+	return nil
+}
+
+// protected tells whether album is sent with protected content, protect is the option. An album is
+// protected as a whole: when one of its files is, by its sidecars or else by the option.
+func protected(album []*FileReport, protect bool) bool {
+	return slices.ContainsFunc(album, func(file *FileReport) bool {
+		if file.Settings != nil && file.Settings.ProtectContent != nil {
+			return *file.Settings.ProtectContent
+		}
+		return protect
+	})
+}
+
+// failAlbum marks the files of album as failed with err, unless they have an error of their own.
+func (s *Sender) failAlbum(album []*FileReport, err error) error {
+	for _, file := range album {
+		if file.Err == nil {
+			file.Err = err
+		}
+	}
+	return err
+}
+
+// item is the album media of file, built (and spooled from an FS) only if there is no file id to reuse.
+func (s *Sender) item(ctx context.Context, ws *tgtemp.Workspace, file *FileReport) (*tgsend.Item, error) {
+	handler := file.Handler
+	if handler.Media == nil {
+		return nil, fmt.Errorf("%s %s can't be in an album", handler.Name, file.Path)
+	}
+	kind := tgcache.KindDocument
+	switch handler.Kind {
+	case KindPhoto:
+		kind = tgcache.KindPhoto
+	case KindVideo:
+		kind = tgcache.KindVideo
+	}
+
+	filename := ""
+	key := ""
+	if handler.Key != nil {
+		// the key may depend on the files next to it (e.g. subtitles), so it's spooled right away.
+		var err error
+		if filename, err = file.spool(ws); err != nil {
+			return nil, err
+		}
+		if tgsend.Reuses(ctx) {
+			if key, err = handler.Key(filename); err != nil {
+				return nil, fmt.Errorf("failed to hash %s: %w", file.Path, err)
+			}
+		}
+	} else {
+		var err error
+		if key, err = file.key(ctx); err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", file.Path, err)
+		}
+	}
+
+	return &tgsend.Item{Kind: kind, Key: key, New: func() (tg.InputMedia, error) {
+		if filename == "" {
+			var err error
+			if filename, err = file.spool(ws); err != nil {
+				file.Err = err
+				return nil, err
+			}
+		}
+		media, err := handler.Media(ctx, ws, filename)
+		if err != nil {
+			// the file is to blame, not the album.
+			file.Err = fmt.Errorf("failed to create %s %s: %w", handler.Name, file.Path, err)
+			return nil, file.Err
+		}
+		return media, nil
+	}}, nil
+}
+
+func (s *Sender) photo() *tg.OptSendPhoto {
+	if s.Photo == nil {
+		return &tg.OptSendPhoto{}
+	}
+	return s.Photo
+}
+
+func (s *Sender) video() *tg.OptSendVideo {
+	if s.Video == nil {
+		return &tg.OptSendVideo{}
+	}
+	return s.Video
+}
+
+func (s *Sender) document() *tg.OptSendDocument {
+	if s.Document == nil {
+		return &tg.OptSendDocument{}
+	}
+	return s.Document
+}
+
+func (s *Sender) mediaGroup() *tg.OptSendMediaGroup {
+	if s.MediaGroup == nil {
+		return &tg.OptSendMediaGroup{}
+	}
+	return s.MediaGroup
+}
@@ -0,0 +1,361 @@
+package tgdir
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgsend"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// DirSettings are the names of the sidecar with the Settings of a directory, the first one found is read.
+var DirSettings = []string{"_dir.yaml", "_dir.yml", "_dir.json"}
+
+// captionSidecars are the extensions of the sidecars with the caption of a file: photo.jpg.txt.
+var captionSidecars = []string{".txt", ".caption"}
+
+// settingsSidecar is the extension of the sidecar with the Settings of a file: photo.jpg.json.
+const settingsSidecar = ".json"
+
+// Settings are how a file is sent, for the people putting the files together: written in sidecars next
+// to the files, they override the options of the Sender. A file's are read from photo.jpg.json and its
+// caption from photo.jpg.txt (or photo.jpg.caption), over the DirSettings of its directory, over the ones
+// of the directories above.
+//
+// The settings of a directory are JSON or a YAML subset: "key: value" lines and a list of buttons,
+//
+//	spoiler: true
+//	parse_mode: HTML
+//	order: -date
+//	buttons:
+//	  - text: Full album
+//	    url: https://example.com/album
+type Settings struct {
+	// Caption replaces the caption, it's cut to Telegram's limit.
+	Caption   *string `json:"caption,omitempty"`
+	ParseMode string  `json:"parse_mode,omitempty"`
+	// Spoiler covers photos and videos with a spoiler animation.
+	Spoiler *bool `json:"spoiler,omitempty"`
+	// ProtectContent keeps the message from being forwarded and saved, an album is protected when one of
+	// its files is.
+	ProtectContent *bool `json:"protect_content,omitempty"`
+	// Grouped sends photos and videos as albums (or not), see Sender.Grouped.
+	Grouped *bool `json:"grouped,omitempty"`
+	// Order is the order of the files of a directory: "lexical", "natural", "mtime", "date" or "size", "-"
+	// in front reverses it. It's a setting of directories only.
+	Order string `json:"order,omitempty"`
+	// Buttons are inline URL buttons under the message, one per row. Albums can't have them, the files with
+	// buttons are sent by themselves.
+	Buttons []*Button `json:"buttons,omitempty"`
+
+	order Order
+}
+
+// Button is an inline URL button.
+type Button struct {
+	Text string `json:"text"`
+	Url  string `json:"url"`
+}
+
+// orders are the orders of Settings.Order by name.
+var orders = map[string]Order{
+	"lexical": OrderLexical,
+	"natural": OrderNatural,
+	"mtime":   OrderModTime,
+	"date":    OrderDate,
+	"size":    OrderSize,
+}
+
+// sidecars drops the sidecars out of files and sets the Settings of the other files from them, fsys is
+// where the files are by their rel paths.
+func (s *Sender) sidecars(fsys fs.FS, files []*FileReport) ([]*FileReport, error) {
+	dirs := map[string]*Settings{}
+	var dirSettings func(dir string) (*Settings, error)
+	dirSettings = func(dir string) (*Settings, error) {
+		if settings, ok := dirs[dir]; ok {
+			return settings, nil
+		}
+		var parent *Settings
+		if dir != "." {
+			var err error
+			if parent, err = dirSettings(path.Dir(dir)); err != nil {
+				return nil, err
+			}
+		}
+		own, err := readDirSettings(fsys, dir)
+		if err != nil {
+			return nil, err
+		}
+		dirs[dir] = parent.merge(own, true)
+		return dirs[dir], nil
+	}
+
+	result := []*FileReport{}
+	for _, file := range files {
+		if isSidecar(fsys, file.rel) {
+			continue
+		}
+		settings, err := dirSettings(path.Dir(file.rel))
+		if err != nil {
+			return nil, err
+		}
+		own, err := readSettings(fsys, file.rel+settingsSidecar)
+		if err != nil {
+			return nil, err
+		}
+		settings = settings.merge(own, false)
+		for _, ext := range captionSidecars {
+			data, err := fs.ReadFile(fsys, file.rel+ext)
+			if err != nil {
+				continue
+			}
+			caption := strings.TrimRight(string(data), "\r\n")
+			settings = settings.merge(&Settings{Caption: &caption}, false)
+			break
+		}
+		file.Settings = settings
+		result = append(result, file)
+	}
+	return result, nil
+}
+
+// isSidecar tells whether the file name of fsys is a sidecar: DirSettings, or the caption or settings of
+// a file next to it.
+func isSidecar(fsys fs.FS, name string) bool {
+	for _, settings := range DirSettings {
+		if path.Base(name) == settings {
+			return true
+		}
+	}
+	for _, ext := range append([]string{settingsSidecar}, captionSidecars...) {
+		if stem, ok := strings.CutSuffix(name, ext); ok && stem != "" && !strings.HasSuffix(stem, "/") {
+			if info, err := fs.Stat(fsys, stem); err == nil && !info.IsDir() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readDirSettings reads the DirSettings of dir, nil if it has none.
+func readDirSettings(fsys fs.FS, dir string) (*Settings, error) {
+	for _, name := range DirSettings {
+		settings, err := readSettings(fsys, path.Join(dir, name))
+		if settings != nil || err != nil {
+			return settings, err
+		}
+	}
+	return nil, nil
+}
+
+// readSettings reads the settings of the sidecar name, nil if there is no such file.
+func readSettings(fsys fs.FS, name string) (*Settings, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if ext := path.Ext(name); ext == ".yaml" || ext == ".yml" {
+		values, err := parseYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		if data, err = json.Marshal(values); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+	}
+	settings := &Settings{}
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	if settings.Order != "" {
+		orderName, reversed := strings.CutPrefix(settings.Order, "-")
+		order, ok := orders[orderName]
+		if !ok {
+			return nil, fmt.Errorf("failed to parse %s: unknown order %q", name, settings.Order)
+		}
+		if reversed {
+			order = Reversed(order)
+		}
+		settings.order = order
+	}
+	return settings, nil
+}
+
+// parseYAML parses the YAML subset of Settings: "key: value" lines, with the value of a key without one
+// being a list of "- key: value" items. Values are strings (quoted or not) and booleans.
+func parseYAML(data []byte) (map[string]any, error) {
+	result := map[string]any{}
+	list := ""
+	var item map[string]any
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if trimmed == line {
+			key, value, ok := strings.Cut(trimmed, ":")
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected key: value", n+1)
+			}
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			list, item = "", nil
+			if value == "" {
+				list = key
+				result[key] = []any{}
+				continue
+			}
+			if result[key], ok = yamlScalar(value); !ok {
+				return nil, fmt.Errorf("line %d: bad value %s", n+1, value)
+			}
+			continue
+		}
+
+		if list == "" {
+			return nil, fmt.Errorf("line %d: unexpected indentation", n+1)
+		}
+		if rest, ok := strings.CutPrefix(trimmed, "-"); ok {
+			item = map[string]any{}
+			result[list] = append(result[list].([]any), item)
+			if trimmed = strings.TrimSpace(rest); trimmed == "" {
+				continue
+			}
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if item == nil || !ok {
+			return nil, fmt.Errorf("line %d: expected - key: value", n+1)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if item[key], ok = yamlScalar(value); !ok {
+			return nil, fmt.Errorf("line %d: bad value %s", n+1, value)
+		}
+	}
+	return result, nil
+}
+
+// yamlScalar is the value of a YAML scalar, ok is false for a broken quoted string.
+func yamlScalar(value string) (any, bool) {
+	switch {
+	case value == "true":
+		return true, true
+	case value == "false":
+		return false, true
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		return unquoted, err == nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return nil, false
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), true
+	default:
+		return value, true
+	}
+}
+
+// merge is settings with the values set in over overriding, dir tells whether over are the settings of
+// a directory: only they set the order.
+func (settings *Settings) merge(over *Settings, dir bool) *Settings {
+	if over == nil {
+		return settings
+	}
+	result := &Settings{}
+	if settings != nil {
+		*result = *settings
+	}
+	if over.Caption != nil {
+		result.Caption = over.Caption
+	}
+	if over.ParseMode != "" {
+		result.ParseMode = over.ParseMode
+	}
+	if over.Spoiler != nil {
+		result.Spoiler = over.Spoiler
+	}
+	if over.ProtectContent != nil {
+		result.ProtectContent = over.ProtectContent
+	}
+	if over.Grouped != nil {
+		result.Grouped = over.Grouped
+	}
+	if over.Buttons != nil {
+		result.Buttons = over.Buttons
+	}
+	if dir && over.order != nil {
+		result.Order, result.order = over.Order, over.order
+	}
+	return result
+}
+
+// caption is the sidecar caption in parseMode (unless the settings have their own), cut to the limit.
+func (settings *Settings) caption(parseMode string) (text string, mode string, ok bool) {
+	if settings == nil || settings.Caption == nil {
+		return "", "", false
+	}
+	if settings.ParseMode != "" {
+		parseMode = settings.ParseMode
+	}
+	return tgsend.TruncateCaption(*settings.Caption, parseMode, captionLimit), parseMode, true
+}
+
+// hasCaption tells whether the sidecars set a caption.
+func (settings *Settings) hasCaption() bool {
+	return settings != nil && settings.Caption != nil
+}
+
+// grouped tells whether the file goes to albums, grouped is the Sender's.
+func (settings *Settings) grouped(grouped bool) bool {
+	if settings == nil {
+		return grouped
+	}
+	if len(settings.Buttons) > 0 {
+		return false
+	}
+	if settings.Grouped != nil {
+		return *settings.Grouped
+	}
+	return grouped
+}
+
+// withSettings is s with the options settings override.
+func (s *Sender) withSettings(settings *Settings) *Sender {
+	if settings == nil {
+		return s
+	}
+	sender := *s
+	photo, video, document := *s.photo(), *s.video(), *s.document()
+	if text, mode, ok := settings.caption(photo.ParseMode); ok {
+		photo.Caption, photo.ParseMode, photo.CaptionEntities = text, mode, nil
+	}
+	if text, mode, ok := settings.caption(video.ParseMode); ok {
+		video.Caption, video.ParseMode, video.CaptionEntities = text, mode, nil
+	}
+	if text, mode, ok := settings.caption(document.ParseMode); ok {
+		document.Caption, document.ParseMode, document.CaptionEntities = text, mode, nil
+	}
+	if settings.Spoiler != nil {
+		photo.HasSpoiler, video.HasSpoiler = *settings.Spoiler, *settings.Spoiler
+	}
+	if settings.ProtectContent != nil {
+		photo.ProtectContent, video.ProtectContent, document.ProtectContent = *settings.ProtectContent, *settings.ProtectContent, *settings.ProtectContent
+	}
+	if len(settings.Buttons) > 0 {
+		keyboard := &tg.InlineKeyboardMarkup{}
+		for _, button := range settings.Buttons {
+			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []*tg.InlineKeyboardButton{{Text: button.Text, Url: button.Url}})
+		}
+		photo.ReplyMarkup, video.ReplyMarkup, document.ReplyMarkup = keyboard, keyboard, keyboard
+	}
+	sender.Photo, sender.Video, sender.Document = &photo, &video, &document
+	return &sender
+}
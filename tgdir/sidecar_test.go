@@ -0,0 +1,112 @@
+package tgdir
+
+import (
+	"bytes"
+	"github.com/kittenbark/tg"
+	"image"
+	"image/png"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSidecars(t *testing.T) {
+	t.Parallel()
+
+	buffer := &bytes.Buffer{}
+	if err := png.Encode(buffer, image.NewGray(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	photo := buffer.Bytes()
+	fsys := fstest.MapFS{
+		"_dir.yaml": {Data: []byte(`# posted by the editors
+spoiler: true
+parse_mode: HTML
+order: -size
+buttons:
+  - text: "Full album"
+    url: https://example.com/album
+`)},
+		"a.png":               {Data: photo},
+		"a.png.txt":           {Data: []byte("<b>first</b>\n")},
+		"b.png":               {Data: append(slices.Clone(photo), 0)},
+		"b.png.json":          {Data: []byte(`{"spoiler": false, "buttons": [], "caption": "second"}`)},
+		"c.png":               {Data: append(slices.Clone(photo), 0, 0)},
+		"c.png.json":          {Data: []byte(`{"buttons": []}`)},
+		"notes.txt":           {Data: []byte("not a sidecar")},
+		"sub/_dir.json":       {Data: []byte(`{"grouped": false, "protect_content": true}`)},
+		"sub/d.png":           {Data: photo},
+		"sub/d.png.caption":   {Data: []byte("fourth")},
+		"sub/e.png":           {Data: photo},
+		"broken/_dir.yaml":    {Data: []byte("order: random\n")},
+		"broken/ignored.json": {Data: []byte("{}")},
+	}
+
+	sender := &Sender{Grouped: true, Filter: &Filter{Exclude: []string{"broken/"}}}
+	files, err := sender.Files(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	if !slices.Equal(paths, []string{"c.png", "b.png", "a.png", "notes.txt", "sub/d.png", "sub/e.png"}) {
+		t.Fatal("expected the sidecars left out and the files by size, the biggest first", paths)
+	}
+
+	a, b, c, d := files[2], files[1], files[0], files[4]
+	if text, mode, ok := a.Settings.caption(""); !ok || text != "<b>first</b>" || mode != ParseModeHTML {
+		t.Fatal("unexpected caption", text, mode)
+	}
+	if text, _, _ := b.Settings.caption(""); text != "second" || *b.Settings.Spoiler {
+		t.Fatal("expected the settings of the file over the directory's", b.Settings)
+	}
+	if _, _, ok := c.Settings.caption(""); ok || !*c.Settings.Spoiler {
+		t.Fatal("expected the settings of the directory", c.Settings)
+	}
+	if text, _, _ := d.Settings.caption(""); text != "fourth" || !*d.Settings.ProtectContent || d.Settings.grouped(true) {
+		t.Fatal("expected the settings of the subdirectory over the parent's", d.Settings)
+	}
+
+	photoOpt := sender.withSettings(a.Settings).photo()
+	keyboard, ok := photoOpt.ReplyMarkup.(*tg.InlineKeyboardMarkup)
+	if !ok || len(keyboard.InlineKeyboard) != 1 || keyboard.InlineKeyboard[0][0].Url != "https://example.com/album" {
+		t.Fatal("expected the button of the directory", photoOpt.ReplyMarkup)
+	}
+	if !photoOpt.HasSpoiler || photoOpt.Caption != "<b>first</b>" || photoOpt.ParseMode != ParseModeHTML {
+		t.Fatal("expected the options overridden", photoOpt)
+	}
+
+	unprotected := false
+	files[0].Settings.ProtectContent, files[1].Settings.ProtectContent = &unprotected, &unprotected
+	if protected(files[:2], true) || !protected(files[:3], true) || !protected(files[3:5], false) {
+		t.Fatal("expected an album protected as its files are, by their sidecars over the option")
+	}
+
+	actions, err := sender.PlanFS(0, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	planned := []string{}
+	for _, action := range actions {
+		planned = append(planned, action.String())
+	}
+	expected := []string{
+		"album c.png (photo), b.png (photo)",
+		"send a.png (photo)",
+		"send notes.txt (document)",
+		"send sub/d.png (photo)",
+		"send sub/e.png (photo)",
+	}
+	if !slices.Equal(planned, expected) {
+		t.Fatal("expected the files with buttons and the ungrouped ones sent by themselves, in order", planned)
+	}
+
+	if _, err := (&Sender{}).Files(fsys); err == nil {
+		t.Fatal("expected an unknown order to fail")
+	}
+	if files, _ := (&Sender{NoSidecars: true}).Files(fsys); len(files) != len(fsys) {
+		t.Fatal("expected the sidecars sent as files", len(files))
+	}
+}
@@ -2,13 +2,7 @@ package tgdir
 
 import (
 	"context"
-	"fmt"
 	"github.com/kittenbark/tg"
-	"github.com/kittenbark/tgmedia/tgvideo"
-	"io/fs"
-	"os"
-	"path/filepath"
-	"sync"
 )
 
 type Opt = tg.OptSendVideo
@@ -30,140 +24,15 @@ func SendDocumentsVerbose(
 	optVideo *tg.OptSendVideo,
 	optDocument *tg.OptSendDocument,
 ) ([]*tg.Message, error) {
-	if optPhoto == nil {
-		optPhoto = &tg.OptSendPhoto{}
-	}
-	if optVideo == nil {
-		optVideo = &tg.OptSendVideo{}
-	}
-	if optDocument == nil {
-		optDocument = &tg.OptSendDocument{}
-	}
-
-	result := []*tg.Message{}
-	err := fs.WalkDir(os.DirFS(dir), ".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-
-		path = filepath.Join(dir, path)
-		switch filepath.Ext(path) {
-		case ".mp4", ".mov":
-			msg, err := tgvideo.Send(ctx, chatId, path, optVideo)
-			if err != nil {
-				return fmt.Errorf("send video %s: %w", path, err)
-			}
-			result = append(result, msg)
-		case ".webm":
-			msg, err := tgvideo.SendH264(ctx, chatId, path, optVideo)
-			if err != nil {
-				return fmt.Errorf("send video %s: %w", path, err)
-			}
-			result = append(result, msg)
-		case ".png", ".jpg", ".jpeg":
-			if !sendPhotosAsDocs {
-				msg, err := tg.SendPhoto(ctx, chatId, tg.FromDisk(path), optPhoto)
-				if err != nil {
-					return fmt.Errorf("send picture %s: %w", path, err)
-				}
-				result = append(result, msg)
-				break
-			}
-			fallthrough
-		default:
-			msg, err := tg.SendDocument(ctx, chatId, tg.FromDisk(path), optDocument)
-			if err != nil {
-				return fmt.Errorf("send document %s: %w", path, err)
-			}
-			result = append(result, msg)
-		}
-
-		return nil
-	})
-
-	return result, err
+	sender := &Sender{PhotosAsDocs: sendPhotosAsDocs, Photo: optPhoto, Video: optVideo, Document: optDocument}
+	report, err := sender.Send(ctx, chatId, dir)
+	return report.Messages(), err
 }
 
 func SendGrouped(ctx context.Context, chatId int64, dir string, opts ...*Opt) ([]*tg.Message, error) {
-	optMediaGroup := optsToMediaGroup(opts)
-	optDocument := optsToDocs(opts)
-
-	result := []*tg.Message{}
-	albumBuff := tg.Album{}
-	cleanups := []func(){}
-	defer func() {
-		wg := sync.WaitGroup{}
-		for _, cleanup := range cleanups {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				cleanup()
-			}()
-		}
-		wg.Wait()
-	}()
-
-	err := fs.WalkDir(os.DirFS(dir), ".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-
-		if len(albumBuff) == 10 {
-			messages, err := tg.SendMediaGroup(ctx, chatId, albumBuff, optMediaGroup)
-			if err != nil {
-				return err
-			}
-			result = append(result, messages...)
-			albumBuff = tg.Album{}
-		}
-
-		path = filepath.Join(dir, path)
-		switch filepath.Ext(path) {
-		case ".mp4", ".mov":
-			vid, cleanup, err := tgvideo.New(path)
-			if err != nil {
-				return fmt.Errorf("failed to create video %s: %w", path, err)
-			}
-			cleanups = append(cleanups, cleanup)
-			albumBuff = append(albumBuff, vid)
-
-		case ".webm":
-			vid, cleanup, err := tgvideo.NewH264(path)
-			if err != nil {
-				return fmt.Errorf("failed to create video %s: %w", path, err)
-			}
-			cleanups = append(cleanups, cleanup)
-			albumBuff = append(albumBuff, vid)
-
-		case ".png", ".jpg", ".jpeg":
-			albumBuff = append(albumBuff, &tg.Photo{Media: tg.FromDisk(path)})
-
-		default:
-			msg, err := tg.SendDocument(ctx, chatId, tg.FromDisk(path), optDocument)
-			if err != nil {
-				return fmt.Errorf("send document %s: %w", path, err)
-			}
-			result = append(result, msg)
-		}
-
-		return nil
-	})
-
-	if len(albumBuff) > 0 {
-		messages, err := tg.SendMediaGroup(ctx, chatId, albumBuff, optMediaGroup)
-		if err != nil {
-			return result, err
-		}
-		result = append(result, messages...)
-	}
-
-	return result, err
+	sender := &Sender{Grouped: true, Caption: optsToCaption(opts), Document: optsToDocs(opts), MediaGroup: optsToMediaGroup(opts)}
+	report, err := sender.Send(ctx, chatId, dir)
+	return report.Messages(), err
 }
 
 func optsToPhoto(opts []*Opt) *tg.OptSendPhoto {
@@ -213,6 +82,16 @@ func optsToDocs(opts []*Opt) *tg.OptSendDocument {
 		ReplyMarkup:          opts[0].ReplyMarkup,
 	}
 }
+
+// optsToCaption is the static caption of opts, for albums: the options of media groups have none. A
+// caption with entities is left to the documents.
+func optsToCaption(opts []*Opt) *Caption {
+	if len(opts) == 0 || opts[0].Caption == "" || len(opts[0].CaptionEntities) > 0 {
+		return nil
+	}
+	return StaticCaption(opts[0].Caption, opts[0].ParseMode)
+}
+
 func optsToMediaGroup(opts []*Opt) *tg.OptSendMediaGroup {
 	if len(opts) == 0 {
 		return &tg.OptSendMediaGroup{}
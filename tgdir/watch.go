@@ -0,0 +1,202 @@
+package tgdir
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Watch sends the files appearing in dir (and its subdirectories) until ctx is done, files arriving together
+// go as albums. See Sender.Watch.
+func Watch(ctx context.Context, chatId int64, dir string, opts ...*Opt) error {
+	sender := &Sender{
+		Grouped:    true,
+		Caption:    optsToCaption(opts),
+		Photo:      optsToPhoto(opts),
+		Video:      optsToVideo(opts),
+		Document:   optsToDocs(opts),
+		MediaGroup: optsToMediaGroup(opts),
+	}
+	return sender.Watch(ctx, chatId, dir, nil)
+}
+
+// WatchOpt tunes Sender.Watch, nil means the defaults.
+type WatchOpt struct {
+	// Stable is how long a file must stay unchanged (size and mtime) to be considered written, 2s by default.
+	Stable time.Duration
+	// Window batches the files getting stable within it into one send (albums with Sender.Grouped), it
+	// starts over with every file, 3s by default.
+	Window time.Duration
+	// Interval is how often dir is rescanned, 1s by default. With inotify (linux) changes are noticed at once,
+	// the rescans only tell when files are stable.
+	Interval time.Duration
+	// Existing sends the files already in dir when watching starts, they're left alone otherwise.
+	Existing bool
+	// OnReport is called with the report of every send, Watch keeps going past failures.
+	OnReport func(report *Report, err error)
+}
+
+func (opt *WatchOpt) stable() time.Duration {
+	if opt == nil || opt.Stable <= 0 {
+		return 2 * time.Second
+	}
+	return opt.Stable
+}
+
+func (opt *WatchOpt) window() time.Duration {
+	if opt == nil || opt.Window <= 0 {
+		return 3 * time.Second
+	}
+	return opt.Window
+}
+
+func (opt *WatchOpt) interval() time.Duration {
+	if opt == nil || opt.Interval <= 0 {
+		return time.Second
+	}
+	return opt.Interval
+}
+
+// observed is the state of a file seen by Watch.
+type observed struct {
+	size    int64
+	modTime time.Time
+	// since is when the file was last seen changing.
+	since time.Time
+	// sent is true once the file (as it is) was sent or deliberately left alone.
+	sent bool
+	// queued is true while the file waits in a batch or is being sent.
+	queued bool
+}
+
+// Watch sends the files appearing in dir until ctx is done, then returns ctx's error. A file is sent once
+// it's stable: unchanged for opt.Stable, the files s.Filter leaves out (partial ones, see Excluded) are
+// skipped. A file changing after it was sent is sent again, a file failing is retried once it's stable
+// again. Watch implies ContinueOnError, the failures are reported to opt.OnReport, the files still waiting
+// when ctx is done too.
+func (s *Sender) Watch(ctx context.Context, chatId int64, dir string, opt *WatchOpt) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	sender := *s
+	sender.ContinueOnError = true
+
+	changes, err := notify(ctx, dir)
+	if err != nil {
+		// no inotify (or too many watches), polling does the same, only slower.
+		changes = nil
+	}
+	ticker := time.NewTicker(opt.interval())
+	defer ticker.Stop()
+
+	files := map[string]*observed{}
+	batch := []*FileReport{}
+	lastAdded := time.Time{}
+
+	now := time.Now()
+	for path, info := range scan(dir, s.Filter) {
+		files[path] = &observed{size: info.Size(), modTime: info.ModTime(), since: now, sent: opt == nil || !opt.Existing}
+	}
+
+	for {
+		now := time.Now()
+		scanned := scan(dir, s.Filter)
+		for path, info := range scanned {
+			file, ok := files[path]
+			if !ok || file.size != info.Size() || !file.modTime.Equal(info.ModTime()) {
+				files[path] = &observed{size: info.Size(), modTime: info.ModTime(), since: now}
+				continue
+			}
+			if file.sent || file.queued || now.Sub(file.since) < opt.stable() {
+				continue
+			}
+			file.queued = true
+			report := sender.file(path, info, nil)
+			if rel, err := filepath.Rel(dir, path); err == nil {
+				report.rel = filepath.ToSlash(rel)
+			}
+			batch = append(batch, report)
+			lastAdded = now
+		}
+		for path := range files {
+			if _, ok := scanned[path]; !ok {
+				delete(files, path)
+			}
+		}
+
+		if len(batch) > 0 && now.Sub(lastAdded) >= opt.window() {
+			report, done, err := sender.sendBatch(ctx, chatId, dir, batch)
+			for _, file := range batch {
+				if observed, ok := files[file.Path]; ok {
+					observed.queued, observed.sent = false, done[file.Path]
+					if !observed.sent {
+						observed.since = time.Now()
+					}
+				}
+			}
+			if opt != nil && opt.OnReport != nil {
+				opt.OnReport(report, err)
+			}
+			batch = []*FileReport{}
+		}
+
+		select {
+		case <-ctx.Done():
+			if len(batch) > 0 && opt != nil && opt.OnReport != nil {
+				// the files waiting weren't sent.
+				for _, file := range batch {
+					file.Err = ctx.Err()
+				}
+				opt.OnReport(&Report{Files: batch}, ctx.Err())
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		case <-changes:
+		}
+	}
+}
+
+// sendBatch sends the files of batch, done are the paths of the ones done with: delivered, or sidecars of
+// the others.
+func (s *Sender) sendBatch(ctx context.Context, chatId int64, dir string, batch []*FileReport) (report *Report, done map[string]bool, err error) {
+	done = map[string]bool{}
+	files := slices.Clone(batch)
+	if !s.NoSidecars {
+		if files, err = s.sidecars(os.DirFS(dir), files); err != nil {
+			return &Report{}, done, err
+		}
+		for _, file := range batch {
+			if !slices.Contains(files, file) {
+				done[file.Path] = true
+			}
+		}
+	}
+	sortFiles(files, s.Order)
+	report, err = s.send(ctx, chatId, files)
+	for _, file := range report.Files {
+		if file.Err == nil && (len(file.Messages) > 0 || file.Journaled != nil) {
+			done[file.Path] = true
+		}
+	}
+	return report, done, err
+}
+
+// scan lists the regular files of dir filter keeps, errors (e.g. a file removed meanwhile) are skipped.
+func scan(dir string, filter *Filter) map[string]fs.FileInfo {
+	result := map[string]fs.FileInfo{}
+	_ = filter.WalkDir(os.DirFS(dir), func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		result[filepath.Join(dir, name)] = info
+		return nil
+	})
+	return result
+}
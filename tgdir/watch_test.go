@@ -0,0 +1,73 @@
+package tgdir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestScan(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{"photo.jpg", "video.mp4.part", ".hidden.jpg", "nested/clip.webm", ".git/HEAD"} {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths := []string{}
+	for path := range scan(dir, nil) {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	expected := []string{filepath.Join(dir, "nested/clip.webm"), filepath.Join(dir, "photo.jpg")}
+	if !slices.Equal(paths, expected) {
+		t.Fatal("unexpected files", paths)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS != "linux" {
+		t.Skip("inotify is linux only")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	changes, err := notify(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nested := filepath.Join(dir, "nested")
+	if err := os.Mkdir(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	wait := func() {
+		select {
+		case <-changes:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no change noticed")
+		}
+	}
+	wait()
+	// the new directory is watched as well.
+	time.Sleep(50 * time.Millisecond)
+	for len(changes) > 0 {
+		<-changes
+	}
+	if err := os.WriteFile(filepath.Join(nested, "photo.jpg"), []byte("photo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wait()
+}
@@ -0,0 +1,281 @@
+package tgexec
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Priority of a job, higher priorities are started first.
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// Job describes what a command is run for, it's passed along in the context (see WithJob).
+type Job struct {
+	// Chat is the key of fair queuing: waiting jobs of the same priority are started round-robin
+	// between chats, so one chat sending a hundred files doesn't block the others.
+	Chat     int64
+	Priority Priority
+	// Threads limits the threads of the job's ffmpeg processes, zero means ffmpeg's default.
+	Threads int
+	// OnQueue is called with the 1-based position of the job in the queue whenever it changes while
+	// the job waits, and with 0 when it starts. It's called with the scheduler locked, keep it short.
+	OnQueue func(position int)
+}
+
+type jobKey struct{}
+
+// WithJob attaches job to ctx.
+func WithJob(ctx context.Context, job *Job) context.Context {
+	return context.WithValue(ctx, jobKey{}, job)
+}
+
+// JobFrom returns the job attached to ctx, nil if there is none.
+func JobFrom(ctx context.Context) *Job {
+	job, _ := ctx.Value(jobKey{}).(*Job)
+	return job
+}
+
+// Scheduler limits the number of concurrently running commands, the rest wait in a queue ordered by
+// priority and fair between chats.
+type Scheduler struct {
+	max int
+
+	mu      sync.Mutex
+	running int
+	// queues are the waiting jobs by priority, a queue round-robins between its chats.
+	queues map[Priority]*fairQueue
+}
+
+// NewScheduler creates a scheduler running at most max commands at once, max below 1 is taken as 1.
+func NewScheduler(max int) *Scheduler {
+	if max < 1 {
+		max = 1
+	}
+	return &Scheduler{max: max, queues: map[Priority]*fairQueue{}}
+}
+
+// Acquire waits for a free slot, the job is taken from ctx (PriorityNormal and chat 0 when there is none).
+// release must be called when the command is done, calling it again does nothing.
+func (s *Scheduler) Acquire(ctx context.Context) (release func(), err error) {
+	job := JobFrom(ctx)
+	if job == nil {
+		job = &Job{}
+	}
+
+	s.mu.Lock()
+	if s.running < s.max && s.waiting() == 0 {
+		s.running++
+		s.mu.Unlock()
+		if job.OnQueue != nil {
+			job.OnQueue(0)
+		}
+		return s.releaser(), nil
+	}
+
+	w := &waiter{job: job, ready: make(chan struct{})}
+	queue, ok := s.queues[job.Priority]
+	if !ok {
+		queue = &fairQueue{chats: map[int64][]*waiter{}}
+		s.queues[job.Priority] = queue
+	}
+	queue.push(w)
+	s.notify()
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return s.releaser(), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-w.ready:
+			// started concurrently with the cancellation, give the slot to the next one.
+			s.running--
+			s.dispatch()
+		default:
+			s.queues[job.Priority].remove(w)
+			s.notify()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Limit wraps runner so that its commands go through the scheduler.
+func (s *Scheduler) Limit(runner Runner) Runner {
+	return RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		release, err := s.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return runner.Run(ctx, cmd)
+	})
+}
+
+// Waiting returns the number of queued jobs.
+func (s *Scheduler) Waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.waiting()
+}
+
+// releaser is the release of a slot taken, it frees the slot once.
+func (s *Scheduler) releaser() func() {
+	once := &sync.Once{}
+	return func() { once.Do(s.release) }
+}
+
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.dispatch()
+}
+
+// dispatch starts waiting jobs while there are free slots, s.mu must be held.
+func (s *Scheduler) dispatch() {
+	started := false
+	for s.running < s.max {
+		w := s.pop()
+		if w == nil {
+			break
+		}
+		s.running++
+		started = true
+		if w.job.OnQueue != nil {
+			w.job.OnQueue(0)
+		}
+		close(w.ready)
+	}
+	if started {
+		s.notify()
+	}
+}
+
+// order returns the waiting jobs in the order they would be started, s.mu must be held.
+func (s *Scheduler) order() []*waiter {
+	result := []*waiter{}
+	for _, priority := range s.priorities() {
+		result = append(result, s.queues[priority].order()...)
+	}
+	return result
+}
+
+// notify reports the queue positions that changed, s.mu must be held.
+func (s *Scheduler) notify() {
+	for i, w := range s.order() {
+		if w.position == i+1 {
+			continue
+		}
+		w.position = i + 1
+		if w.job.OnQueue != nil {
+			w.job.OnQueue(w.position)
+		}
+	}
+}
+
+func (s *Scheduler) pop() *waiter {
+	for _, priority := range s.priorities() {
+		if w := s.queues[priority].pop(); w != nil {
+			return w
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) waiting() int {
+	total := 0
+	for _, queue := range s.queues {
+		total += queue.len()
+	}
+	return total
+}
+
+// priorities returns the priorities with waiting jobs, highest first.
+func (s *Scheduler) priorities() []Priority {
+	result := []Priority{}
+	for priority, queue := range s.queues {
+		if queue.len() > 0 {
+			result = append(result, priority)
+		}
+	}
+	slices.Sort(result)
+	slices.Reverse(result)
+	return result
+}
+
+type waiter struct {
+	job      *Job
+	ready    chan struct{}
+	position int
+}
+
+// fairQueue is a FIFO per chat, chats take turns in the order they got in line.
+type fairQueue struct {
+	rotation []int64
+	chats    map[int64][]*waiter
+}
+
+func (q *fairQueue) push(w *waiter) {
+	if len(q.chats[w.job.Chat]) == 0 {
+		q.rotation = append(q.rotation, w.job.Chat)
+	}
+	q.chats[w.job.Chat] = append(q.chats[w.job.Chat], w)
+}
+
+func (q *fairQueue) pop() *waiter {
+	if len(q.rotation) == 0 {
+		return nil
+	}
+	chat := q.rotation[0]
+	q.rotation = q.rotation[1:]
+	w := q.chats[chat][0]
+	q.chats[chat] = q.chats[chat][1:]
+	if len(q.chats[chat]) > 0 {
+		q.rotation = append(q.rotation, chat)
+	} else {
+		delete(q.chats, chat)
+	}
+	return w
+}
+
+func (q *fairQueue) remove(w *waiter) {
+	chat := w.job.Chat
+	q.chats[chat] = slices.DeleteFunc(q.chats[chat], func(other *waiter) bool { return other == w })
+	if len(q.chats[chat]) == 0 {
+		delete(q.chats, chat)
+		q.rotation = slices.DeleteFunc(q.rotation, func(other int64) bool { return other == chat })
+	}
+}
+
+// order simulates popping everything.
+func (q *fairQueue) order() []*waiter {
+	result := []*waiter{}
+	for round := 0; ; round++ {
+		added := false
+		for _, chat := range q.rotation {
+			if round < len(q.chats[chat]) {
+				result = append(result, q.chats[chat][round])
+				added = true
+			}
+		}
+		if !added {
+			return result
+		}
+	}
+}
+
+func (q *fairQueue) len() int {
+	total := 0
+	for _, waiters := range q.chats {
+		total += len(waiters)
+	}
+	return total
+}
@@ -0,0 +1,115 @@
+package tgexec
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	t.Parallel()
+
+	scheduler := NewScheduler(1)
+	release, err := scheduler.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu := sync.Mutex{}
+	started := []string{}
+	positions := map[string]int{}
+	wg := sync.WaitGroup{}
+	queued := 0
+	enqueue := func(name string, job *Job) {
+		job.OnQueue = func(position int) { positions[name] = position }
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := scheduler.Acquire(WithJob(context.Background(), job))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			started = append(started, name)
+			mu.Unlock()
+			release()
+		}()
+		queued++
+		for scheduler.Waiting() != queued {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	enqueue("a1", &Job{Chat: 1})
+	enqueue("a2", &Job{Chat: 1})
+	enqueue("a3", &Job{Chat: 1})
+	enqueue("b1", &Job{Chat: 2})
+	enqueue("low", &Job{Chat: 3, Priority: PriorityLow})
+	enqueue("high", &Job{Chat: 4, Priority: PriorityHigh})
+
+	scheduler.mu.Lock()
+	expectedPositions := map[string]int{"high": 1, "a1": 2, "b1": 3, "a2": 4, "a3": 5, "low": 6}
+	for name, position := range expectedPositions {
+		if positions[name] != position {
+			t.Error(name, "position", positions[name], "!=", position)
+		}
+	}
+	scheduler.mu.Unlock()
+
+	release()
+	wg.Wait()
+	if expected := []string{"high", "a1", "b1", "a2", "a3", "low"}; !slices.Equal(started, expected) {
+		t.Fatal(started, "!=", expected)
+	}
+	for name, position := range positions {
+		if position != 0 {
+			t.Fatal(name, "was expected to report start, position", position)
+		}
+	}
+}
+
+func TestScheduler_Cancel(t *testing.T) {
+	t.Parallel()
+
+	scheduler := NewScheduler(1)
+	release, err := scheduler.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if _, err := scheduler.Acquire(ctx); err == nil {
+		t.Fatal("an error was expected, the only slot is taken")
+	}
+	if waiting := scheduler.Waiting(); waiting != 0 {
+		t.Fatal("the cancelled job is still queued", waiting)
+	}
+}
+
+func TestScheduler_Release(t *testing.T) {
+	t.Parallel()
+
+	scheduler := NewScheduler(0)
+	release, err := scheduler.Acquire(context.Background())
+	if err != nil {
+		t.Fatal("expected a slot with max taken as 1", err)
+	}
+	release()
+	release()
+
+	first, err := scheduler.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := scheduler.Acquire(ctx); err == nil {
+		t.Fatal("expected a released slot freed once, the second acquire to wait")
+	}
+}
@@ -0,0 +1,92 @@
+package tgexec
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"slices"
+	"sync"
+)
+
+// Command is an external tool invocation, Name is the binary (e.g. tgvideo.Ffmpeg).
+type Command struct {
+	Name   string
+	Args   []string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Runner runs commands, every ffmpeg/ffprobe call of tgmedia goes through one.
+type Runner interface {
+	Run(ctx context.Context, cmd *Command) error
+}
+
+// RunnerFunc is a function Runner.
+type RunnerFunc func(ctx context.Context, cmd *Command) error
+
+func (f RunnerFunc) Run(ctx context.Context, cmd *Command) error {
+	return f(ctx, cmd)
+}
+
+// Default runs commands with os/exec.
+var Default Runner = &Exec{}
+
+// Exec runs commands with os/exec, optionally through a wrapper, e.g. {"nice", "-n", "19"},
+// {"firejail", "--quiet"} or {"docker", "exec", "-i", "ffmpeg"}.
+type Exec struct {
+	Wrapper []string
+	// Dir is the working directory, the current one when empty.
+	Dir string
+	// Env is the environment, the current one when nil.
+	Env []string
+}
+
+func (e *Exec) Run(ctx context.Context, cmd *Command) error {
+	args := append(slices.Clone(e.Wrapper), cmd.Name)
+	args = append(args, cmd.Args...)
+
+	command := exec.CommandContext(ctx, args[0], args[1:]...)
+	command.Dir = e.Dir
+	command.Env = e.Env
+	command.Stdin = cmd.Stdin
+	command.Stdout = cmd.Stdout
+	command.Stderr = cmd.Stderr
+	return command.Run()
+}
+
+// Recorder is a fake Runner for tests: it records every command and answers with Respond instead of
+// running anything.
+type Recorder struct {
+	// Respond plays the tool, e.g. writes ffprobe's json to cmd.Stdout or creates the output file. Nil
+	// means every command succeeds with no output.
+	Respond func(ctx context.Context, cmd *Command) error
+
+	mu       sync.Mutex
+	commands []*Command
+}
+
+func (r *Recorder) Run(ctx context.Context, cmd *Command) error {
+	r.mu.Lock()
+	r.commands = append(r.commands, &Command{Name: cmd.Name, Args: slices.Clone(cmd.Args)})
+	r.mu.Unlock()
+
+	if r.Respond == nil {
+		return nil
+	}
+	return r.Respond(ctx, cmd)
+}
+
+// Commands returns the recorded commands (without their streams) in the order they were run.
+func (r *Recorder) Commands() []*Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.commands)
+}
+
+// Reset forgets the recorded commands.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = nil
+}
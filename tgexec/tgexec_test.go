@@ -0,0 +1,50 @@
+package tgexec
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExec(t *testing.T) {
+	t.Parallel()
+
+	stdout := &bytes.Buffer{}
+	runner := &Exec{Wrapper: []string{"env"}}
+	err := runner.Run(context.Background(), &Command{
+		Name:   "cat",
+		Stdin:  strings.NewReader("kitten"),
+		Stdout: stdout,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "kitten" {
+		t.Fatal(stdout.String(), " != kitten")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+
+	recorder := &Recorder{Respond: func(ctx context.Context, cmd *Command) error {
+		_, err := cmd.Stdout.Write([]byte(strings.Join(cmd.Args, " ")))
+		return err
+	}}
+	stdout := &bytes.Buffer{}
+	if err := recorder.Run(context.Background(), &Command{Name: "ffprobe", Args: []string{"-v", "error"}, Stdout: stdout}); err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout.String() != "-v error" {
+		t.Fatal(stdout.String(), " != -v error")
+	}
+	if commands := recorder.Commands(); len(commands) != 1 || commands[0].Name != "ffprobe" {
+		t.Fatal("unexpected commands", commands)
+	}
+	recorder.Reset()
+	if commands := recorder.Commands(); len(commands) != 0 {
+		t.Fatal("no commands expected after reset", commands)
+	}
+}
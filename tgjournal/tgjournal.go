@@ -0,0 +1,162 @@
+package tgjournal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kittenbark/tgmedia/tgcache"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is a file delivered to a chat.
+type Entry struct {
+	ChatId     int64     `json:"chat_id"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mtime"`
+	Hash       string    `json:"hash"`
+	MessageIds []int64   `json:"message_ids"`
+}
+
+type entryKey struct {
+	chatId int64
+	path   string
+}
+
+// Journal is a checkpoint of a long upload: a file of json lines, one per delivered file, appended as
+// sends complete. A later run with the same journal skips what's already there, so a restart doesn't post
+// duplicates.
+type Journal struct {
+	mu      sync.Mutex
+	file    *os.File
+	entries map[entryKey]*Entry
+}
+
+// Open opens (creating if needed) the journal in filename, it must be closed.
+func Open(filename string) (*Journal, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, errors.Join(err, file.Close())
+	}
+	// a line cut off by a crash: that file wasn't recorded, it's sent again. The line is dropped, the next
+	// ones would be appended to it.
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	if complete < len(data) {
+		if err := file.Truncate(int64(complete)); err != nil {
+			return nil, errors.Join(fmt.Errorf("tgjournal: failed to drop a torn line: %w", err), file.Close())
+		}
+	}
+
+	journal := &Journal{file: file, entries: map[entryKey]*Entry{}}
+	for _, line := range bytes.Split(data[:complete], []byte("\n")) {
+		entry := &Entry{}
+		if err := json.Unmarshal(line, entry); err != nil {
+			continue
+		}
+		journal.entries[entryKey{entry.ChatId, entry.Path}] = entry
+	}
+	return journal, nil
+}
+
+// Delivered returns the entry of path if it was delivered to chatId and hasn't changed since: same size,
+// and same mtime or content.
+func (j *Journal) Delivered(chatId int64, path string, info fs.FileInfo) (*Entry, bool) {
+	return j.delivered(chatId, path, info, func() (io.ReadCloser, error) { return os.Open(path) })
+}
+
+// DeliveredFS is Delivered for the file name of fsys, the entry is keyed by name: a journal should hold a
+// single fsys per chat.
+func (j *Journal) DeliveredFS(chatId int64, fsys fs.FS, name string, info fs.FileInfo) (*Entry, bool) {
+	return j.delivered(chatId, name, info, func() (io.ReadCloser, error) { return fsys.Open(name) })
+}
+
+func (j *Journal) delivered(chatId int64, path string, info fs.FileInfo, open func() (io.ReadCloser, error)) (*Entry, bool) {
+	if j == nil {
+		return nil, false
+	}
+	j.mu.Lock()
+	entry, ok := j.entries[entryKey{chatId, path}]
+	j.mu.Unlock()
+	if !ok || entry.Size != info.Size() {
+		return nil, false
+	}
+	if entry.ModTime.Equal(info.ModTime()) {
+		return entry, true
+	}
+
+	// touched, maybe not changed.
+	hash, err := hash(open)
+	if err != nil || hash != entry.Hash {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Record appends the delivery of path to chatId, info is the file as it was sent.
+func (j *Journal) Record(chatId int64, path string, info fs.FileInfo, messageIds []int64) error {
+	return j.record(chatId, path, info, messageIds, func() (io.ReadCloser, error) { return os.Open(path) })
+}
+
+// RecordFS is Record for the file name of fsys, see DeliveredFS.
+func (j *Journal) RecordFS(chatId int64, fsys fs.FS, name string, info fs.FileInfo, messageIds []int64) error {
+	return j.record(chatId, name, info, messageIds, func() (io.ReadCloser, error) { return fsys.Open(name) })
+}
+
+func (j *Journal) record(chatId int64, path string, info fs.FileInfo, messageIds []int64, open func() (io.ReadCloser, error)) error {
+	if j == nil {
+		return nil
+	}
+	hash, err := hash(open)
+	if err != nil {
+		return fmt.Errorf("tgjournal: failed to hash %s: %w", path, err)
+	}
+	entry := &Entry{
+		ChatId:     chatId,
+		Path:       path,
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+		Hash:       hash,
+		MessageIds: messageIds,
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("tgjournal: failed to record %s: %w", path, err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("tgjournal: failed to record %s: %w", path, err)
+	}
+	j.entries[entryKey{chatId, path}] = entry
+	return nil
+}
+
+// hash is the content hash of the file opened by open.
+func hash(open func() (io.ReadCloser, error)) (string, error) {
+	file, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return tgcache.HashReader(file)
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
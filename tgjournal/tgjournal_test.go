@@ -0,0 +1,169 @@
+package tgjournal
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	photo, document := filepath.Join(dir, "photo.jpg"), filepath.Join(dir, "notes.txt")
+	for _, filename := range []string{photo, document} {
+		if err := os.WriteFile(filename, []byte(filename), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stat := func(filename string) os.FileInfo {
+		info, err := os.Stat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	journalFile := filepath.Join(dir, "journal.jsonl")
+	journal, err := Open(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Record(42, photo, stat(photo), []int64{7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := Open(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Close()
+	if entry, ok := resumed.Delivered(42, photo, stat(photo)); !ok || entry.MessageIds[0] != 7 {
+		t.Fatal("the photo was expected to be delivered", entry)
+	}
+	if _, ok := resumed.Delivered(43, photo, stat(photo)); ok {
+		t.Fatal("the photo wasn't delivered to another chat")
+	}
+	if _, ok := resumed.Delivered(42, document, stat(document)); ok {
+		t.Fatal("the document wasn't delivered")
+	}
+
+	touched := time.Now().Add(time.Hour)
+	if err := os.Chtimes(photo, touched, touched); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resumed.Delivered(42, photo, stat(photo)); !ok {
+		t.Fatal("a touched but unchanged photo was expected to be delivered")
+	}
+	// same size, another content.
+	if err := os.WriteFile(photo, []byte(strings.Repeat("x", len(photo))), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resumed.Delivered(42, photo, stat(photo)); ok {
+		t.Fatal("an edited photo was expected to be sent again")
+	}
+}
+
+func TestJournal_FS(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{"photo.jpg": {Data: []byte("photo"), ModTime: time.Unix(1, 0)}}
+	stat := func() fs.FileInfo {
+		info, err := fs.Stat(fsys, "photo.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	journal, err := Open(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	if err := journal.RecordFS(42, fsys, "photo.jpg", stat(), []int64{7}); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys["photo.jpg"].ModTime = time.Unix(2, 0)
+	if _, ok := journal.DeliveredFS(42, fsys, "photo.jpg", stat()); !ok {
+		t.Fatal("a touched but unchanged photo was expected to be delivered")
+	}
+	fsys["photo.jpg"].Data = []byte("PHOTO")
+	if _, ok := journal.DeliveredFS(42, fsys, "photo.jpg", stat()); ok {
+		t.Fatal("an edited photo was expected to be sent again")
+	}
+}
+
+func TestJournal_TornLine(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	photo, document := filepath.Join(dir, "photo.jpg"), filepath.Join(dir, "notes.txt")
+	for _, filename := range []string{photo, document} {
+		if err := os.WriteFile(filename, []byte(filename), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	photoInfo, err := os.Stat(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentInfo, err := os.Stat(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journalFile := filepath.Join(dir, "journal.jsonl")
+	journal, err := Open(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Record(42, photo, photoInfo, []int64{7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// a crash in the middle of the next record.
+	file, err := os.OpenFile(journalFile, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"chat_id":42,"path":"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := Open(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resumed.Record(42, document, documentInfo, []int64{8}); err != nil {
+		t.Fatal(err)
+	}
+	if err := resumed.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := Open(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if _, ok := again.Delivered(42, photo, photoInfo); !ok {
+		t.Fatal("the photo was expected to be delivered")
+	}
+	if _, ok := again.Delivered(42, document, documentInfo); !ok {
+		t.Fatal("the document recorded after the torn line was expected to be delivered")
+	}
+}
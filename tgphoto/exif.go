@@ -0,0 +1,140 @@
+package tgphoto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// EXIF tags the date is read from.
+const (
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagDateTimeOriginal   = 0x9003
+	tagDateTimeDigitized  = 0x9004
+	tagOffsetTimeOriginal = 0x9011
+	typeASCII             = 2
+)
+
+// Taken reads when a JPEG photo was taken from its EXIF: DateTimeOriginal, DateTimeDigitized or DateTime,
+// in the time zone of OffsetTimeOriginal (local time without it). ok is false if there is no date.
+func Taken(reader io.Reader) (taken time.Time, ok bool) {
+	r := bufio.NewReader(reader)
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(r, soi); err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return time.Time{}, false
+	}
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil || header[0] != 0xFF {
+			return time.Time{}, false
+		}
+		marker, size := header[1], int(binary.BigEndian.Uint16(header[2:]))-2
+		if marker == 0xDA || marker == 0xD9 || size < 0 {
+			// image data starts, EXIF comes before it.
+			return time.Time{}, false
+		}
+		if marker != 0xE1 {
+			if _, err := r.Discard(size); err != nil {
+				return time.Time{}, false
+			}
+			continue
+		}
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return time.Time{}, false
+		}
+		if tiff, found := bytes.CutPrefix(segment, []byte("Exif\x00\x00")); found {
+			return exifDate(tiff)
+		}
+	}
+}
+
+// TakenFile is Taken for a file.
+func TakenFile(filename string) (time.Time, bool) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer file.Close()
+	return Taken(file)
+}
+
+// exifDate reads the date of the TIFF structure of EXIF.
+func exifDate(tiff []byte) (time.Time, bool) {
+	if len(tiff) < 8 {
+		return time.Time{}, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return time.Time{}, false
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return time.Time{}, false
+	}
+
+	ifd0 := readIFD(tiff, order, order.Uint32(tiff[4:]))
+	exif := map[uint16][]byte{}
+	if pointer, ok := ifd0[tagExifIFD]; ok && len(pointer) == 4 {
+		exif = readIFD(tiff, order, order.Uint32(pointer))
+	}
+
+	location := time.Local
+	if offset, ok := exif[tagOffsetTimeOriginal]; ok {
+		if zone, err := time.Parse("-07:00", asciiValue(offset)); err == nil {
+			location = zone.Location()
+		}
+	}
+	for _, value := range [][]byte{exif[tagDateTimeOriginal], exif[tagDateTimeDigitized], ifd0[tagDateTime]} {
+		if value == nil {
+			continue
+		}
+		if taken, err := time.ParseInLocation("2006:01:02 15:04:05", asciiValue(value), location); err == nil {
+			return taken, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// readIFD reads the ASCII and pointer values of the IFD at offset, by tag.
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) map[uint16][]byte {
+	result := map[uint16][]byte{}
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return result
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := range count {
+		start := uint64(offset) + 2 + uint64(i)*12
+		if start+12 > uint64(len(tiff)) {
+			break
+		}
+		entry := tiff[start : start+12]
+		tag, typ, n := order.Uint16(entry), order.Uint16(entry[2:]), order.Uint32(entry[4:])
+		switch {
+		case tag == tagExifIFD:
+			result[tag] = entry[8:12]
+		case typ == typeASCII && n <= 4:
+			result[tag] = entry[8 : 8+n]
+		case typ == typeASCII:
+			at := uint64(order.Uint32(entry[8:]))
+			if at+uint64(n) <= uint64(len(tiff)) {
+				result[tag] = tiff[at : at+uint64(n)]
+			}
+		}
+	}
+	return result
+}
+
+// asciiValue is an EXIF ASCII value without its NUL.
+func asciiValue(value []byte) string {
+	return strings.TrimRight(string(value), "\x00 ")
+}
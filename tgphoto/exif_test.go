@@ -0,0 +1,44 @@
+package tgphoto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestTaken(t *testing.T) {
+	t.Parallel()
+
+	// IFD0 points to the EXIF IFD, which has DateTimeOriginal and OffsetTimeOriginal.
+	tiff := &bytes.Buffer{}
+	tiff.WriteString("II")
+	_ = binary.Write(tiff, binary.LittleEndian, []uint16{42})
+	_ = binary.Write(tiff, binary.LittleEndian, []uint32{8})
+	// IFD0 at 8: one entry, 2+12+4 bytes, the EXIF IFD follows at 26.
+	_ = binary.Write(tiff, binary.LittleEndian, []uint16{1, tagExifIFD, 4})
+	_ = binary.Write(tiff, binary.LittleEndian, []uint32{1, 26, 0})
+	// EXIF IFD at 26: two entries, 2+24+4 bytes, the values follow at 56.
+	_ = binary.Write(tiff, binary.LittleEndian, []uint16{2, tagDateTimeOriginal, typeASCII})
+	_ = binary.Write(tiff, binary.LittleEndian, []uint32{20, 56})
+	_ = binary.Write(tiff, binary.LittleEndian, []uint16{tagOffsetTimeOriginal, typeASCII})
+	_ = binary.Write(tiff, binary.LittleEndian, []uint32{7, 76, 0})
+	tiff.WriteString("2024:05:17 21:30:05\x00+03:00\x00")
+
+	jpeg := &bytes.Buffer{}
+	jpeg.Write([]byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x04, 0x00, 0x00})
+	jpeg.Write([]byte{0xFF, 0xE1})
+	_ = binary.Write(jpeg, binary.BigEndian, uint16(2+6+tiff.Len()))
+	jpeg.WriteString("Exif\x00\x00")
+	jpeg.Write(tiff.Bytes())
+	jpeg.Write([]byte{0xFF, 0xDA})
+
+	taken, ok := Taken(jpeg)
+	expected := time.Date(2024, 5, 17, 21, 30, 5, 0, time.FixedZone("", 3*60*60))
+	if !ok || !taken.Equal(expected) {
+		t.Fatal("unexpected date", taken, ok)
+	}
+	if _, ok := Taken(bytes.NewReader([]byte{0xFF, 0xD8, 0xFF, 0xDA})); ok {
+		t.Fatal("no date was expected without EXIF")
+	}
+}
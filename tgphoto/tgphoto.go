@@ -0,0 +1,59 @@
+package tgphoto
+
+import (
+	"context"
+	"fmt"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgsend"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"github.com/kittenbark/tgmedia/tgvideo"
+	"path/filepath"
+)
+
+func Send(ctx context.Context, chatId int64, filename string, opts ...*tg.OptSendPhoto) (*tg.Message, error) {
+	return tgsend.Photo(ctx, chatId, filename, opts...)
+}
+
+// SendOverlay sends the picture with overlay (a watermark) drawn on top of it, the original file is untouched.
+func SendOverlay(ctx context.Context, chatId int64, filename string, overlay *tgvideo.Overlay, opts ...*tg.OptSendPhoto) (*tg.Message, error) {
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	defer ws.Close()
+
+	photo, err := NewOverlayIn(ctx, ws, filename, overlay)
+	if err != nil {
+		return nil, err
+	}
+	return tgsend.SendPhoto(ctx, chatId, photo.Media, opts...)
+}
+
+// NewOverlay is SendOverlay for albums, cleanup removes the watermarked copy and must be called after sending.
+func NewOverlay(filename string, overlay *tgvideo.Overlay) (photo *tg.Photo, cleanup func(), err error) {
+	ws, err := tgtemp.New(context.Background())
+	if err != nil {
+		return nil, func() {}, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	cleanup = func() { _ = ws.Close() }
+
+	photo, err = NewOverlayIn(context.Background(), ws, filename, overlay)
+	if err != nil {
+		defer cleanup()
+		return nil, func() {}, err
+	}
+	return photo, cleanup, nil
+}
+
+// NewOverlayIn is NewOverlay keeping the watermarked copy in ws, it lives until ws is closed.
+func NewOverlayIn(ctx context.Context, ws *tgtemp.Workspace, filename string, overlay *tgvideo.Overlay) (*tg.Photo, error) {
+	watermarked, err := ws.Path("*.jpg")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	if err := tgvideo.OverlayImage(ctx, filename, watermarked, overlay); err != nil {
+		return nil, err
+	}
+
+	return &tg.Photo{Media: tg.FromDisk(watermarked, filepath.Base(filename))}, nil
+}
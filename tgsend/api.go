@@ -0,0 +1,46 @@
+package tgsend
+
+import (
+	"context"
+	"github.com/kittenbark/tg"
+)
+
+// SendVideo is tg.SendVideo paced by Limiter and going through Retry, as every Bot API call of tgmedia does.
+func SendVideo(ctx context.Context, chatId int64, video tg.InputFile, opts ...*tg.OptSendVideo) (*tg.Message, error) {
+	return call(ctx, chatId, 1, func() (*tg.Message, error) { return tg.SendVideo(ctx, chatId, video, opts...) })
+}
+
+// SendPhoto is tg.SendPhoto paced by Limiter and going through Retry.
+func SendPhoto(ctx context.Context, chatId int64, photo tg.InputFile, opts ...*tg.OptSendPhoto) (*tg.Message, error) {
+	return call(ctx, chatId, 1, func() (*tg.Message, error) { return tg.SendPhoto(ctx, chatId, photo, opts...) })
+}
+
+// SendDocument is tg.SendDocument paced by Limiter and going through Retry.
+func SendDocument(ctx context.Context, chatId int64, document tg.InputFile, opts ...*tg.OptSendDocument) (*tg.Message, error) {
+	return call(ctx, chatId, 1, func() (*tg.Message, error) { return tg.SendDocument(ctx, chatId, document, opts...) })
+}
+
+// SendMediaGroup is tg.SendMediaGroup paced by Limiter (as len(media) messages) and going through Retry.
+func SendMediaGroup(ctx context.Context, chatId int64, media tg.Album, opts ...*tg.OptSendMediaGroup) ([]*tg.Message, error) {
+	return call(ctx, chatId, len(media), func() ([]*tg.Message, error) {
+		return tg.SendMediaGroup(ctx, chatId, media, opts...)
+	})
+}
+
+// CopyMessages is tg.CopyMessages paced by Limiter (as len(messageIds) messages) and going through Retry.
+func CopyMessages(ctx context.Context, chatId int64, fromChatId int64, messageIds []int64, opts ...*tg.OptCopyMessages) ([]*tg.MessageId, error) {
+	return call(ctx, chatId, len(messageIds), func() ([]*tg.MessageId, error) {
+		return tg.CopyMessages(ctx, chatId, fromChatId, messageIds, opts...)
+	})
+}
+
+// call runs a send of n messages to chatId, every attempt waits for Limiter.
+func call[T any](ctx context.Context, chatId int64, n int, send func() (T, error)) (T, error) {
+	return retry(ctx, false, func() (T, error) {
+		if err := Limiter.Wait(ctx, chatId, n); err != nil {
+			var zero T
+			return zero, err
+		}
+		return send()
+	})
+}
@@ -0,0 +1,181 @@
+package tgsend
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CaptionLimit is the most characters (UTF-16 code units) of visible text a caption takes.
+const CaptionLimit = 1024
+
+// Parse modes of captions, see tg's ParseMode options.
+const (
+	parseModeHTML       = "HTML"
+	parseModeMarkdownV2 = "MarkdownV2"
+	parseModeMarkdown   = "Markdown"
+)
+
+// CaptionLength is the characters of text Telegram counts against CaptionLimit: the visible ones, in
+// UTF-16 code units, the markup of parseMode left out.
+func CaptionLength(text string, parseMode string) int {
+	length := 0
+	walkCaption(text, parseMode, func(end int, visible int, open []string, safe bool) bool {
+		length = visible
+		return true
+	})
+	return length
+}
+
+// TruncateCaption cuts text to limit characters (UTF-16 code units, as Telegram counts them) of visible
+// text, with an ellipsis. The entities open where it's cut are closed, links aren't cut through.
+func TruncateCaption(text string, parseMode string, limit int) string {
+	if CaptionLength(text, parseMode) <= limit {
+		return text
+	}
+
+	cut, closing := 0, ""
+	walkCaption(text, parseMode, func(end int, visible int, open []string, safe bool) bool {
+		if visible > limit-1 {
+			return false
+		}
+		if safe {
+			cut, closing = end, closingMarkup(open, parseMode)
+		}
+		return true
+	})
+	return text[:cut] + "…" + closing
+}
+
+// walkCaption calls step after every piece of text: end is where the piece ends, visible the characters
+// shown up to there, open the entities open there and safe tells whether the text may be cut there.
+// Walking stops when step returns false.
+func walkCaption(text string, parseMode string, step func(end int, visible int, open []string, safe bool) bool) {
+	visible := 0
+	open := []string{}
+	toggle := func(marker string) {
+		if len(open) > 0 && open[len(open)-1] == marker {
+			open = open[:len(open)-1]
+		} else {
+			open = append(open, marker)
+		}
+	}
+	char := func(i int) int {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		visible += max(utf16.RuneLen(r), 1)
+		return i + size
+	}
+
+	code := ""
+	link := false
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		switch parseMode {
+		case parseModeHTML:
+			switch end := htmlEnd(rest); {
+			case end > 0 && rest[0] == '<':
+				tag := rest[1:end]
+				if name, closed := strings.CutPrefix(tag, "/"); closed {
+					if len(open) > 0 && open[len(open)-1] == name {
+						open = open[:len(open)-1]
+					}
+				} else if !strings.HasSuffix(tag, "/") {
+					name, _, _ := strings.Cut(tag, " ")
+					open = append(open, name)
+				}
+				i += end + 1
+			case end > 0 && rest[0] == '&':
+				visible++
+				i += end + 1
+			default:
+				i = char(i)
+			}
+		case parseModeMarkdownV2, parseModeMarkdown:
+			v2 := parseMode == parseModeMarkdownV2
+			switch {
+			case rest[0] == '\\' && len(rest) > 1:
+				i = char(i + 1)
+			case code != "":
+				if strings.HasPrefix(rest, code) {
+					toggle(code)
+					i += len(code)
+					code = ""
+				} else {
+					i = char(i)
+				}
+			case strings.HasPrefix(rest, "```"), rest[0] == '`':
+				code = "`"
+				if strings.HasPrefix(rest, "```") {
+					code = "```"
+				}
+				toggle(code)
+				i += len(code)
+			case rest[0] == '[':
+				link = true
+				i++
+			case link && strings.HasPrefix(rest, "]("):
+				end := strings.IndexByte(rest, ')')
+				if end < 0 {
+					end = len(rest) - 1
+				}
+				link = false
+				i += end + 1
+			case v2 && (strings.HasPrefix(rest, "||") || strings.HasPrefix(rest, "__")):
+				toggle(rest[:2])
+				i += 2
+			case rest[0] == '*' || rest[0] == '_' || v2 && rest[0] == '~':
+				toggle(rest[:1])
+				i++
+			default:
+				i = char(i)
+			}
+		default:
+			i = char(i)
+		}
+		if !step(i, visible, open, !link) {
+			return
+		}
+	}
+}
+
+// htmlEnd is the index of the '>' ending the tag or the ';' ending the entity text starts with, 0 if it
+// starts with neither. The quoted attribute values of a tag may hold anything, e.g. an href with '&' or '>'.
+func htmlEnd(text string) int {
+	switch text[0] {
+	case '<':
+		quote := byte(0)
+		for i := 1; i < len(text); i++ {
+			switch c := text[i]; {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+			case c == '"' || c == '\'':
+				quote = c
+			case c == '>':
+				return i
+			case c == '<':
+				return 0
+			}
+		}
+	case '&':
+		end := strings.IndexAny(text[1:], "<>;& ") + 1
+		if end > 0 && text[end] == ';' && end <= 10 {
+			return end
+		}
+	}
+	return 0
+}
+
+// closingMarkup closes the entities of open, innermost first.
+func closingMarkup(open []string, parseMode string) string {
+	builder := &strings.Builder{}
+	for i := len(open) - 1; i >= 0; i-- {
+		if parseMode == parseModeHTML {
+			builder.WriteString("</" + open[i] + ">")
+		} else {
+			builder.WriteString(open[i])
+		}
+	}
+	return builder.String()
+}
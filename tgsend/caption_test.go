@@ -0,0 +1,33 @@
+package tgsend
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncateCaption(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("x", 2000)
+	for _, test := range []struct {
+		text      string
+		parseMode string
+		expected  string
+	}{
+		{"short", "", "short"},
+		{long, "", strings.Repeat("x", 9) + "…"},
+		{"<b>&amp;" + long + "</b>", parseModeHTML, "<b>&amp;" + strings.Repeat("x", 8) + "…</b>"},
+		{`<a href="https://x/?a=1&b=2">` + long + "</a>", parseModeHTML, `<a href="https://x/?a=1&b=2">` + strings.Repeat("x", 9) + "…</a>"},
+		{"a & b <i>" + long, parseModeHTML, "a & b <i>xxx…</i>"},
+		{"*bold _it" + long + "_*", parseModeMarkdownV2, "*bold _it" + strings.Repeat("x", 2) + "…_*"},
+		{"see [link](https://example.com) " + long, parseModeMarkdownV2, "see [link](https://example.com) …"},
+		{"see [" + long + "](https://example.com)", parseModeMarkdownV2, "see …"},
+		{"\\*" + long, parseModeMarkdownV2, "\\*" + strings.Repeat("x", 8) + "…"},
+		{"😀" + long, "", "😀" + strings.Repeat("x", 7) + "…"},
+	} {
+		truncated := TruncateCaption(test.text, test.parseMode, 10)
+		if truncated != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, truncated)
+		}
+	}
+}
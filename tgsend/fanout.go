@@ -0,0 +1,129 @@
+package tgsend
+
+import (
+	"context"
+	"errors"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgcache"
+)
+
+// copyMessagesLimit is the most messages a single copyMessages call takes.
+const copyMessagesLimit = 100
+
+// Target is a chat media is fanned out to.
+type Target struct {
+	ChatId int64
+	// MessageThreadId is the topic of a forum chat.
+	MessageThreadId     int64
+	DisableNotification bool
+}
+
+// FanoutResult is the outcome of a fan-out for one target.
+type FanoutResult struct {
+	Target *Target
+	// MessageIds are the ids of the messages in the target chat, copyMessages doesn't return the messages
+	// themselves.
+	MessageIds []int64
+	// Copied is false when the messages were sent to the target, e.g. for the first target or when
+	// copying was refused (protected content).
+	Copied bool
+	Err    error
+}
+
+// Fanout sends the same media to every target: send is called for the first one, the messages it sent are
+// then copied to the rest with copyMessages, without uploading anything again (albums stay albums).
+// When a copy fails, send is called for that target, reusing the file ids of the first send (a memory
+// store is used for the call when there is no file id store). The results follow the order of targets.
+func Fanout(ctx context.Context, targets []*Target, send func(ctx context.Context, target *Target) ([]*tg.Message, error)) []*FanoutResult {
+	if len(targets) == 0 {
+		return nil
+	}
+	if !Reuses(ctx) {
+		ctx = WithFileIds(ctx, tgcache.NewMemoryStore())
+	}
+
+	results := make([]*FanoutResult, len(targets))
+	origin := targets[0]
+	messages, err := send(ctx, origin)
+	results[0] = &FanoutResult{Target: origin, MessageIds: messageIds(messages), Err: err}
+	if err != nil {
+		// nothing to copy, let the others try on their own.
+		for i, target := range targets[1:] {
+			results[i+1] = resend(ctx, target, send)
+		}
+		return results
+	}
+
+	for i, target := range targets[1:] {
+		ids, err := copyMessages(ctx, target, origin.ChatId, results[0].MessageIds)
+		if err != nil && len(ids) > 0 {
+			// partly copied, sending it all again would duplicate.
+			results[i+1] = &FanoutResult{Target: target, MessageIds: ids, Copied: true, Err: err}
+			continue
+		}
+		if err != nil {
+			results[i+1] = resend(ctx, target, send)
+			if results[i+1].Err != nil {
+				results[i+1].Err = errors.Join(err, results[i+1].Err)
+			}
+			continue
+		}
+		results[i+1] = &FanoutResult{Target: target, MessageIds: ids, Copied: true}
+	}
+	return results
+}
+
+// FanoutErr joins the errors of results, nil if every target got its messages.
+func FanoutErr(results []*FanoutResult) error {
+	errs := []error{}
+	for _, result := range results {
+		errs = append(errs, result.Err)
+	}
+	return errors.Join(errs...)
+}
+
+// TargetOpts is a copy of the first of opts (a new one if there is none) with the topic and notification
+// of target, fields points to them in the copy: for the fan-out sends of every option type.
+func TargetOpts[T any](opts []*T, target *Target, fields func(opt *T) (messageThreadId *int64, disableNotification *bool)) []*T {
+	opt := new(T)
+	if len(opts) > 0 && opts[0] != nil {
+		copied := *opts[0]
+		opt = &copied
+	}
+	messageThreadId, disableNotification := fields(opt)
+	*messageThreadId = target.MessageThreadId
+	*disableNotification = *disableNotification || target.DisableNotification
+	return []*T{opt}
+}
+
+func resend(ctx context.Context, target *Target, send func(ctx context.Context, target *Target) ([]*tg.Message, error)) *FanoutResult {
+	messages, err := send(ctx, target)
+	return &FanoutResult{Target: target, MessageIds: messageIds(messages), Err: err}
+}
+
+func copyMessages(ctx context.Context, target *Target, fromChatId int64, ids []int64) ([]int64, error) {
+	result := []int64{}
+	for start := 0; start < len(ids); start += copyMessagesLimit {
+		copied, err := CopyMessages(ctx, target.ChatId, fromChatId, ids[start:min(start+copyMessagesLimit, len(ids))], &tg.OptCopyMessages{
+			MessageThreadId:     target.MessageThreadId,
+			DisableNotification: target.DisableNotification,
+		})
+		if err != nil {
+			return result, err
+		}
+		for _, id := range copied {
+			result = append(result, id.MessageId)
+		}
+	}
+	return result, nil
+}
+
+func messageIds(messages []*tg.Message) []int64 {
+	result := []int64{}
+	for _, msg := range messages {
+		if msg != nil {
+			result = append(result, msg.MessageId)
+		}
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+package tgsend
+
+import (
+	"context"
+	"errors"
+	"github.com/kittenbark/tg"
+	"testing"
+)
+
+func TestFanout_FailedOrigin(t *testing.T) {
+	t.Parallel()
+
+	targets := []*Target{{ChatId: 1}, {ChatId: 2, MessageThreadId: 7}, {ChatId: 3}}
+	refused := errors.New("telegram: Forbidden: bot was kicked from the group chat")
+	results := Fanout(context.Background(), targets, func(ctx context.Context, target *Target) ([]*tg.Message, error) {
+		if !Reuses(ctx) {
+			t.Error("fan-out sends were expected to reuse file ids")
+		}
+		if target.ChatId == 1 {
+			return nil, refused
+		}
+		return []*tg.Message{{MessageId: target.ChatId * 10}}, nil
+	})
+
+	if len(results) != len(targets) {
+		t.Fatal("expected a result per target", len(results))
+	}
+	if !errors.Is(results[0].Err, refused) || !errors.Is(FanoutErr(results), refused) {
+		t.Fatal("unexpected error of the first target", results[0].Err)
+	}
+	for i, result := range results[1:] {
+		if result.Target != targets[i+1] || result.Err != nil || result.Copied {
+			t.Fatal("the other targets were expected to be sent to", result)
+		}
+		if len(result.MessageIds) != 1 || result.MessageIds[0] != result.Target.ChatId*10 {
+			t.Fatal("unexpected message ids", result.MessageIds)
+		}
+	}
+}
+
+func TestTargetOpts(t *testing.T) {
+	t.Parallel()
+
+	fields := func(opt *tg.OptSendVideo) (*int64, *bool) { return &opt.MessageThreadId, &opt.DisableNotification }
+	opt := &tg.OptSendVideo{Caption: "caption", DisableNotification: true}
+	opts := TargetOpts([]*tg.OptSendVideo{opt}, &Target{ChatId: 1, MessageThreadId: 7}, fields)
+	if opts[0] == opt || opts[0].Caption != "caption" || opts[0].MessageThreadId != 7 || !opts[0].DisableNotification {
+		t.Fatal("expected a copy with the topic of the target, still silent", opts[0])
+	}
+	if opt.MessageThreadId != 0 {
+		t.Fatal("expected the options left as they were", opt)
+	}
+	if opts := TargetOpts(nil, &Target{ChatId: 1, DisableNotification: true}, fields); !opts[0].DisableNotification {
+		t.Fatal("expected the notification of the target", opts[0])
+	}
+}
@@ -0,0 +1,137 @@
+package tgsend
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter paces every Bot API call of tgmedia, so that bulk sends don't hit flood control. Nil disables it.
+var Limiter = NewRateLimiter()
+
+// Rate is Messages per Per, up to Messages may go at once.
+type Rate struct {
+	Messages int
+	Per      time.Duration
+}
+
+func (r Rate) perSecond() float64 {
+	return float64(r.Messages) / r.Per.Seconds()
+}
+
+// channelIdBelow is where the ids of channels and supergroups start (-100xxxxxxxxxx).
+const channelIdBelow = -1_000_000_000_000
+
+// RateLimiter is a token bucket per chat plus a global one. A message takes a token, a media group as many as
+// it has items: it goes once the chat's bucket could take it (or is full), the rest is a debt the next
+// messages wait for. The rates of a chat are read when it's first seen, set them before sending.
+type RateLimiter struct {
+	// Private is the rate of chats with users, Telegram asks for about a message per second.
+	Private Rate
+	// Group is the rate of basic groups, about 20 messages per minute.
+	Group Rate
+	// Channel is the rate of channels and supergroups, their ids don't tell them apart.
+	Channel Rate
+	// Global is the rate of the bot across all chats, about 30 messages per second.
+	Global Rate
+
+	mu        sync.Mutex
+	overrides map[int64]Rate
+	chats     map[int64]*bucket
+	global    *bucket
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		Private:   Rate{Messages: 1, Per: time.Second},
+		Group:     Rate{Messages: 20, Per: time.Minute},
+		Channel:   Rate{Messages: 20, Per: time.Minute},
+		Global:    Rate{Messages: 30, Per: time.Second},
+		overrides: map[int64]Rate{},
+		chats:     map[int64]*bucket{},
+	}
+}
+
+// SetRate overrides the rate of chatId, e.g. for a channel known to take more.
+func (l *RateLimiter) SetRate(chatId int64, rate Rate) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.overrides[chatId] = rate
+	delete(l.chats, chatId)
+}
+
+// Wait blocks until n messages may be sent to chatId.
+func (l *RateLimiter) Wait(ctx context.Context, chatId int64, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	chat, ok := l.chats[chatId]
+	if !ok {
+		chat = newBucket(l.rate(chatId), now)
+		l.chats[chatId] = chat
+	}
+	if l.global == nil {
+		l.global = newBucket(l.Global, now)
+	}
+	delay := max(chat.reserve(n, now), l.global.reserve(n, now))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	if err := sleep(ctx, delay); err != nil {
+		l.mu.Lock()
+		chat.tokens += float64(n)
+		l.global.tokens += float64(n)
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// rate of chatId, l.mu must be held.
+func (l *RateLimiter) rate(chatId int64) Rate {
+	if rate, ok := l.overrides[chatId]; ok {
+		return rate
+	}
+	switch {
+	case chatId > 0:
+		return l.Private
+	case chatId <= channelIdBelow:
+		return l.Channel
+	default:
+		return l.Group
+	}
+}
+
+type bucket struct {
+	rate   Rate
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate Rate, now time.Time) *bucket {
+	return &bucket{rate: rate, tokens: float64(rate.Messages), last: now}
+}
+
+// reserve takes n tokens and returns how long to wait before using them: until the bucket has
+// min(n, capacity) tokens, the rest stays a debt (negative tokens).
+func (b *bucket) reserve(n int, now time.Time) time.Duration {
+	if b.rate.Messages <= 0 || b.rate.Per <= 0 {
+		return 0
+	}
+
+	b.tokens = min(float64(b.rate.Messages), b.tokens+now.Sub(b.last).Seconds()*b.rate.perSecond())
+	b.last = now
+
+	need := float64(min(n, b.rate.Messages))
+	delay := time.Duration(0)
+	if b.tokens < need {
+		delay = time.Duration((need - b.tokens) / b.rate.perSecond() * float64(time.Second))
+	}
+	b.tokens -= float64(n)
+	return delay
+}
@@ -0,0 +1,62 @@
+package tgsend
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	group := newBucket(Rate{Messages: 20, Per: time.Minute}, now)
+	if delay := group.reserve(10, now); delay != 0 {
+		t.Fatal("an album was expected to fit into a full bucket", delay)
+	}
+	if delay := group.reserve(10, now); delay != 0 {
+		t.Fatal("the second album was expected to fit too", delay)
+	}
+	if delay := group.reserve(1, now); delay != 3*time.Second {
+		t.Fatal("expected to wait for a token (3s at 20/min), got", delay)
+	}
+
+	private := newBucket(Rate{Messages: 1, Per: time.Second}, now)
+	if delay := private.reserve(10, now); delay != 0 {
+		t.Fatal("an album was expected to go into a full private chat bucket", delay)
+	}
+	if delay := private.reserve(1, now.Add(time.Second)); delay != 9*time.Second {
+		t.Fatal("the next message was expected to wait for the album's debt, got", delay)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	limiter := NewRateLimiter()
+	limiter.SetRate(1, Rate{Messages: 2, Per: 100 * time.Millisecond})
+	if rate := limiter.rate(-1001234567890); rate != limiter.Channel {
+		t.Fatal("a -100 id was expected to be a channel", rate)
+	}
+	if rate := limiter.rate(-1234567); rate != limiter.Group {
+		t.Fatal("a negative id was expected to be a group", rate)
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	for range 4 {
+		if err := limiter.Wait(ctx, 1, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatal("4 messages at 2 per 100ms were expected to take about 100ms, took", elapsed)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := limiter.Wait(canceled, 1, 10); !errors.Is(err, context.Canceled) {
+		t.Fatal("expected the wait to be canceled", err)
+	}
+}
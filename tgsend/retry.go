@@ -0,0 +1,176 @@
+package tgsend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Retry is the retry policy of every Bot API call of tgmedia, nil disables retries.
+var Retry = &RetryPolicy{
+	MaxAttempts:   5,
+	BaseDelay:     time.Second,
+	MaxDelay:      time.Minute,
+	MaxRetryAfter: 5 * time.Minute,
+}
+
+// RetryPolicy retries calls failing on flood control (honoring Telegram's retry_after), network and server
+// errors (with exponential backoff and jitter). A send isn't idempotent: a failure that doesn't tell whether
+// Telegram got the request (a timeout, a reset connection, 500 or 504) is only retried when RetryUnsure is
+// set, otherwise the message could be sent twice.
+type RetryPolicy struct {
+	// MaxAttempts caps the calls of an operation, the first one included.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry, it doubles with every attempt up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxRetryAfter is the longest flood control wait honored, asked to wait longer the call fails at once.
+	MaxRetryAfter time.Duration
+	// RetryUnsure retries sends failing in a way that doesn't tell whether they went through, duplicates
+	// are possible.
+	RetryUnsure bool
+}
+
+// RetryError is the last error of an operation that ran out of attempts.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("tgsend: gave up after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// Do calls op until it succeeds, fails in a way not worth retrying or runs out of attempts. An idempotent
+// op (safe to repeat, e.g. a read) is retried on unsure failures too. A nil policy calls op once.
+func (p *RetryPolicy) Do(ctx context.Context, idempotent bool, op func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || p == nil {
+			return err
+		}
+
+		class, retryAfter := classify(err)
+		switch {
+		case class == failurePermanent, class == failureUnsure && !idempotent && !p.RetryUnsure:
+			return err
+		case attempt >= p.MaxAttempts:
+			return &RetryError{Attempts: attempt, Err: err}
+		case retryAfter > p.MaxRetryAfter:
+			return err
+		}
+
+		delay := retryAfter
+		if delay == 0 {
+			delay = p.backoff(attempt)
+		}
+		if ctxErr := sleep(ctx, delay); ctxErr != nil {
+			return errors.Join(err, ctxErr)
+		}
+	}
+}
+
+// backoff is the delay before the retry following attempt: exponential, half of it random.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 1 {
+		return delay
+	}
+	return delay/2 + rand.N(delay/2)
+}
+
+// retry is RetryPolicy.Do with Retry for an op returning a value.
+func retry[T any](ctx context.Context, idempotent bool, op func() (T, error)) (T, error) {
+	var result T
+	err := Retry.Do(ctx, idempotent, func() error {
+		var err error
+		result, err = op()
+		return err
+	})
+	return result, err
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type failure int
+
+const (
+	// failurePermanent is not worth retrying, e.g. a bad request.
+	failurePermanent failure = iota
+	// failureSafe surely wasn't processed by Telegram: flood control, a connection that was never made.
+	failureSafe
+	// failureUnsure may have been processed: a timeout, a reset connection, some server errors.
+	failureUnsure
+)
+
+// The errors of the Bot API start with "telegram: " and the description (or status) of the error, the
+// rest of an error's text (e.g. the file path of the request) says nothing about it.
+var (
+	retryAfterRegexp   = regexp.MustCompile(`(?i)\btelegram: too many requests: retry after (\d+)`)
+	safeStatusRegexp   = regexp.MustCompile(`(?i)\btelegram: (429\b|502\b|503\b|too many requests|bad gateway|service unavailable)`)
+	unsureStatusRegexp = regexp.MustCompile(`(?i)\btelegram: (500\b|504\b|internal server error|gateway timeout)`)
+)
+
+// classify tells whether err is worth retrying, and after how long Telegram asks to.
+func classify(err error) (failure, time.Duration) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return failurePermanent, 0
+	}
+
+	text := err.Error()
+	if match := retryAfterRegexp.FindStringSubmatch(text); match != nil {
+		seconds, _ := strconv.Atoi(match[1])
+		return failureSafe, time.Duration(seconds) * time.Second
+	}
+	if safeStatusRegexp.MatchString(text) {
+		return failureSafe, 0
+	}
+	if unsureStatusRegexp.MatchString(text) {
+		return failureUnsure, 0
+	}
+
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &dnsErr):
+		return failureSafe, 0
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return failureSafe, 0
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return failureSafe, 0
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		strings.Contains(text, "connection reset") {
+		return failureUnsure, 0
+	}
+	return failurePermanent, 0
+}
@@ -0,0 +1,85 @@
+package tgsend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	read := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	for _, test := range []struct {
+		err        error
+		class      failure
+		retryAfter time.Duration
+	}{
+		{errors.New("telegram: Too Many Requests: retry after 35"), failureSafe, 35 * time.Second},
+		{errors.New("telegram: Bad Gateway (502)"), failureSafe, 0},
+		{fmt.Errorf("post sendVideo: %w", dial), failureSafe, 0},
+		{&net.DNSError{Err: "no such host", Name: "api.telegram.org"}, failureSafe, 0},
+		{fmt.Errorf("post sendVideo: %w", read), failureUnsure, 0},
+		{errors.New("telegram: Gateway Timeout (504)"), failureUnsure, 0},
+		{errors.New("telegram: Bad Request: chat not found"), failurePermanent, 0},
+		{errors.New("send video clip-503.mp4: telegram: Bad Request: wrong file"), failurePermanent, 0},
+		{errors.New("send photo 500 photos/a.jpg: telegram: Bad Request: IMAGE_PROCESS_FAILED"), failurePermanent, 0},
+		{errors.New("send photo retry after 5/a.jpg: telegram: Bad Request: wrong file"), failurePermanent, 0},
+		{errors.New("send video clip-503.mp4: telegram: Service Unavailable"), failureSafe, 0},
+		{fmt.Errorf("post sendVideo: %w", context.Canceled), failurePermanent, 0},
+	} {
+		class, retryAfter := classify(test.err)
+		if class != test.class || retryAfter != test.retryAfter {
+			t.Errorf("classify(%q) = %d, %s; expected %d, %s", test.err, class, retryAfter, test.class, test.retryAfter)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, MaxRetryAfter: time.Second}
+	failing := func(calls *int, errs ...error) func() error {
+		return func() error {
+			*calls++
+			if *calls <= len(errs) {
+				return errs[*calls-1]
+			}
+			return nil
+		}
+	}
+	ctx := context.Background()
+	flood := errors.New("telegram: Too Many Requests: retry after 0")
+	reset := fmt.Errorf("post: %w", syscall.ECONNRESET)
+
+	calls := 0
+	if err := policy.Do(ctx, false, failing(&calls, flood, flood)); err != nil || calls != 3 {
+		t.Fatal("flood control was expected to be waited out", err, calls)
+	}
+
+	calls = 0
+	var retryErr *RetryError
+	if err := policy.Do(ctx, false, failing(&calls, flood, flood, flood, flood)); !errors.As(err, &retryErr) || calls != 3 {
+		t.Fatal("attempts were expected to be capped", err, calls)
+	}
+
+	calls = 0
+	if err := policy.Do(ctx, false, failing(&calls, reset)); !errors.Is(err, syscall.ECONNRESET) || calls != 1 {
+		t.Fatal("a send was expected not to be retried on an unsure failure", err, calls)
+	}
+	calls = 0
+	if err := policy.Do(ctx, true, failing(&calls, reset)); err != nil || calls != 2 {
+		t.Fatal("an idempotent op was expected to be retried", err, calls)
+	}
+
+	calls = 0
+	long := errors.New("telegram: Too Many Requests: retry after 3600")
+	if err := policy.Do(ctx, false, failing(&calls, long)); err != long || calls != 1 {
+		t.Fatal("a wait past MaxRetryAfter was expected to fail at once", err, calls)
+	}
+}
@@ -0,0 +1,264 @@
+package tgsend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgcache"
+	"regexp"
+)
+
+// FileIds remembers the file_id of uploaded media, sending the same content again reuses it instead of
+// uploading. Nil (default) disables it, e.g. tgcache.NewMemoryStore() or tgcache.OpenFileStore(...) enable it.
+var FileIds tgcache.FileIdStore
+
+type fileIdsKey struct{}
+
+// WithFileIds makes the sends under ctx use store instead of FileIds.
+func WithFileIds(ctx context.Context, store tgcache.FileIdStore) context.Context {
+	return context.WithValue(ctx, fileIdsKey{}, store)
+}
+
+// Reuses reports whether the sends under ctx reuse file ids, i.e. whether keys are worth computing.
+func Reuses(ctx context.Context) bool {
+	return fileIds(ctx) != nil
+}
+
+func fileIds(ctx context.Context) tgcache.FileIdStore {
+	if store, ok := ctx.Value(fileIdsKey{}).(tgcache.FileIdStore); ok {
+		return store
+	}
+	return FileIds
+}
+
+// Key returns the key of filename for the file id store (its content hash), or "" when ids aren't reused.
+func Key(ctx context.Context, filename string) (string, error) {
+	if !Reuses(ctx) {
+		return "", nil
+	}
+	return tgcache.Hash(filename)
+}
+
+// Media sends a single media of kind: with the file_id stored for key (calling send) when there is one, and
+// otherwise by uploading it (calling upload), then the file_id Telegram returns is stored. A stored id
+// Telegram rejects is forgotten and the media is uploaded. An empty key means no reuse.
+func Media(
+	ctx context.Context,
+	kind tgcache.Kind,
+	key string,
+	send func(media tg.InputFile) (*tg.Message, error),
+	upload func() (*tg.Message, error),
+) (*tg.Message, error) {
+	store := fileIds(ctx)
+	if store == nil || key == "" {
+		return upload()
+	}
+
+	if fileId, ok := store.Get(key, kind); ok {
+		msg, err := send(tg.FromCloud(fileId))
+		if err == nil || !isStaleFileId(err) {
+			return msg, err
+		}
+		if err := store.Delete(key, kind); err != nil {
+			return nil, fmt.Errorf("failed to forget stale file_id: %w", err)
+		}
+	}
+
+	msg, err := upload()
+	if err != nil {
+		return msg, err
+	}
+	if fileId := FileId(msg, kind); fileId != "" {
+		if err := store.Put(key, kind, fileId); err != nil {
+			return msg, fmt.Errorf("failed to store file_id: %w", err)
+		}
+	}
+	return msg, nil
+}
+
+// Photo sends the picture filename, see Media.
+func Photo(ctx context.Context, chatId int64, filename string, opts ...*tg.OptSendPhoto) (*tg.Message, error) {
+	key, err := Key(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	return Media(ctx, tgcache.KindPhoto, key,
+		func(media tg.InputFile) (*tg.Message, error) { return SendPhoto(ctx, chatId, media, opts...) },
+		func() (*tg.Message, error) { return SendPhoto(ctx, chatId, tg.FromDisk(filename), opts...) },
+	)
+}
+
+// Document sends filename as a document, see Media.
+func Document(ctx context.Context, chatId int64, filename string, opts ...*tg.OptSendDocument) (*tg.Message, error) {
+	key, err := Key(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	return Media(ctx, tgcache.KindDocument, key,
+		func(media tg.InputFile) (*tg.Message, error) { return SendDocument(ctx, chatId, media, opts...) },
+		func() (*tg.Message, error) { return SendDocument(ctx, chatId, tg.FromDisk(filename), opts...) },
+	)
+}
+
+// Item is a media of an album.
+type Item struct {
+	Kind tgcache.Kind
+	// Key is the key of the media in FileIds, empty means no reuse.
+	Key string
+	// New builds the media to upload, it's only called when there is no usable file_id for Key.
+	New func() (tg.InputMedia, error)
+	// Caption (in ParseMode) is set on the media, built or reused.
+	Caption   string
+	ParseMode string
+	// Spoiler covers a photo or video with a spoiler animation.
+	Spoiler bool
+}
+
+// MediaGroup sends the items as an album, the ones with a stored file_id aren't built nor uploaded. When
+// Telegram rejects a stored id, the ids of the album are forgotten and it's uploaded as a whole.
+func MediaGroup(ctx context.Context, chatId int64, items []*Item, opts ...*tg.OptSendMediaGroup) ([]*tg.Message, error) {
+	store := fileIds(ctx)
+	album := make(tg.Album, len(items))
+	reused := []*Item{}
+	for i, item := range items {
+		if store == nil || item.Key == "" {
+			continue
+		}
+		if fileId, ok := store.Get(item.Key, item.Kind); ok {
+			album[i] = fromCloud(item.Kind, fileId)
+			reused = append(reused, item)
+		}
+	}
+
+	if len(reused) > 0 {
+		if err := build(items, album); err != nil {
+			return nil, err
+		}
+		messages, err := SendMediaGroup(ctx, chatId, album, opts...)
+		if err == nil {
+			return messages, remember(store, items, messages)
+		}
+		if !isStaleFileId(err) {
+			return messages, err
+		}
+		for _, item := range reused {
+			if err := store.Delete(item.Key, item.Kind); err != nil {
+				return nil, fmt.Errorf("failed to forget stale file_id: %w", err)
+			}
+		}
+		album = make(tg.Album, len(items))
+	}
+
+	if err := build(items, album); err != nil {
+		return nil, err
+	}
+	messages, err := SendMediaGroup(ctx, chatId, album, opts...)
+	if err != nil {
+		return messages, err
+	}
+	return messages, remember(store, items, messages)
+}
+
+// build fills the missing media of album and sets the captions and spoilers.
+func build(items []*Item, album tg.Album) error {
+	for i, item := range items {
+		if album[i] == nil {
+			media, err := item.New()
+			if err != nil {
+				return err
+			}
+			album[i] = media
+		}
+		if item.Caption != "" {
+			setCaption(album[i], item.Caption, item.ParseMode)
+		}
+		if item.Spoiler {
+			setSpoiler(album[i])
+		}
+	}
+	return nil
+}
+
+func setCaption(media tg.InputMedia, caption string, parseMode string) {
+	switch media := media.(type) {
+	case *tg.Photo:
+		media.Caption, media.ParseMode = caption, parseMode
+	case *tg.Video:
+		media.Caption, media.ParseMode = caption, parseMode
+	case *tg.Document:
+		media.Caption, media.ParseMode = caption, parseMode
+	}
+}
+
+func setSpoiler(media tg.InputMedia) {
+	switch media := media.(type) {
+	case *tg.Photo:
+		media.HasSpoiler = true
+	case *tg.Video:
+		media.HasSpoiler = true
+	}
+}
+
+func remember(store tgcache.FileIdStore, items []*Item, messages []*tg.Message) error {
+	if store == nil || len(messages) != len(items) {
+		return nil
+	}
+	errs := []error{}
+	for i, item := range items {
+		if item.Key == "" {
+			continue
+		}
+		if fileId := FileId(messages[i], item.Kind); fileId != "" {
+			errs = append(errs, store.Put(item.Key, item.Kind, fileId))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to store file_id: %w", err)
+	}
+	return nil
+}
+
+func fromCloud(kind tgcache.Kind, fileId string) tg.InputMedia {
+	switch kind {
+	case tgcache.KindPhoto:
+		return &tg.Photo{Media: tg.FromCloud(fileId)}
+	case tgcache.KindVideo:
+		return &tg.Video{Media: tg.FromCloud(fileId), SupportsStreaming: true}
+	default:
+		return &tg.Document{Media: tg.FromCloud(fileId)}
+	}
+}
+
+// FileId returns the file_id of the media of msg, "" when it has no media of kind (e.g. Telegram turned
+// a video it couldn't play into a document).
+func FileId(msg *tg.Message, kind tgcache.Kind) string {
+	if msg == nil {
+		return ""
+	}
+	switch kind {
+	case tgcache.KindPhoto:
+		if len(msg.Photo) > 0 {
+			return msg.Photo[len(msg.Photo)-1].FileId
+		}
+	case tgcache.KindVideo:
+		if msg.Video != nil {
+			return msg.Video.FileId
+		}
+	case tgcache.KindDocument:
+		if msg.Document != nil {
+			return msg.Document.FileId
+		}
+	}
+	return ""
+}
+
+// staleFileIdRegexp matches the Bad Request (400) errors of the Bot API rejecting a file_id, e.g. "Bad
+// Request: wrong file identifier/HTTP URL specified" for an id of another bot or of a deleted file. As in
+// classify, only the error of the Bot API is looked at, not the rest of the text.
+var staleFileIdRegexp = regexp.MustCompile(`(?i)\btelegram: (?:400\b:? ?)?bad request: (?:wrong (?:remote )?file identifier|wrong file_id|invalid file_id|file_reference_|file reference)`)
+
+// isStaleFileId reports whether Telegram rejected a file_id.
+func isStaleFileId(err error) bool {
+	return staleFileIdRegexp.MatchString(err.Error())
+}
@@ -0,0 +1,67 @@
+package tgsend
+
+import (
+	"context"
+	"errors"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgcache"
+	"testing"
+)
+
+// TestMedia isn't parallel: it swaps the package-level FileIds.
+func TestMedia(t *testing.T) {
+	defer func(store tgcache.FileIdStore) { FileIds = store }(FileIds)
+	store := tgcache.NewMemoryStore()
+	FileIds = store
+
+	sent, uploaded := 0, 0
+	send := func(media tg.InputFile) (*tg.Message, error) {
+		sent++
+		return nil, errors.New("telegram: Bad Request: wrong file identifier/HTTP URL specified")
+	}
+	upload := func() (*tg.Message, error) {
+		uploaded++
+		return &tg.Message{}, nil
+	}
+
+	if err := store.Put("stale", tgcache.KindVideo, "expired_id"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Media(context.Background(), tgcache.KindVideo, "stale", send, upload); err != nil {
+		t.Fatal(err)
+	}
+	if sent != 1 || uploaded != 1 {
+		t.Fatal("expected the stale id to be tried and the video uploaded", sent, uploaded)
+	}
+	if fileId, ok := store.Get("stale", tgcache.KindVideo); ok {
+		t.Fatal("stale file_id was expected to be forgotten", fileId)
+	}
+
+	rejected := errors.New("telegram: Bad Request: chat not found")
+	if err := store.Put("fresh", tgcache.KindVideo, "id"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Media(context.Background(), tgcache.KindVideo, "fresh", func(tg.InputFile) (*tg.Message, error) {
+		return nil, rejected
+	}, upload)
+	if !errors.Is(err, rejected) || uploaded != 1 {
+		t.Fatal("other errors were expected to be returned as is", err, uploaded)
+	}
+}
+
+func TestIsStaleFileId(t *testing.T) {
+	t.Parallel()
+
+	for text, stale := range map[string]bool{
+		"telegram: Bad Request: wrong file identifier/HTTP URL specified":                   true,
+		"telegram: 400: Bad Request: wrong remote file identifier specified: Wrong padding": true,
+		"send video: telegram: Bad Request: FILE_REFERENCE_EXPIRED":                         true,
+		"telegram: Bad Request: chat not found":                                             false,
+		"failed to open /tmp/file_id.mp4: no such file or directory":                        false,
+		"send video file_id.mp4: telegram: Forbidden: bot was blocked by the user":          false,
+	} {
+		if isStaleFileId(errors.New(text)) != stale {
+			t.Error(text, "expected stale:", stale)
+		}
+	}
+}
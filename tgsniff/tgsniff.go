@@ -0,0 +1,172 @@
+package tgsniff
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HeadSize is how much of a file detection looks at.
+const HeadSize = 512
+
+// Media types detected beyond http.DetectContentType.
+const (
+	MP4       = "video/mp4"
+	QuickTime = "video/quicktime"
+	WebM      = "video/webm"
+	Matroska  = "video/x-matroska"
+	HEIC      = "image/heic"
+	HEIF      = "image/heif"
+	AVIF      = "image/avif"
+	M4A       = "audio/mp4"
+	OGG       = "audio/ogg"
+	FLAC      = "audio/flac"
+	Zip       = "application/zip"
+	Tar       = "application/x-tar"
+	Gzip      = "application/gzip"
+	Unknown   = "application/octet-stream"
+)
+
+// Detect is the media type of a file starting with head (see HeadSize), without parameters. It's Unknown
+// (or "text/plain" for text) when the content tells nothing.
+func Detect(head []byte) string {
+	if typ := signature(head); typ != "" {
+		return typ
+	}
+	typ, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	if typ == "application/x-gzip" {
+		return Gzip
+	}
+	return typ
+}
+
+// Type is the media type of the file name starting with head: detected from the content, the extension
+// only breaks ties (text, content nothing is known about, or a .webm some encoders mark as Matroska).
+func Type(name string, head []byte) string {
+	typ := Detect(head)
+	if typ == Matroska && ByExt(name) == WebM {
+		return WebM
+	}
+	if typ != Unknown && typ != "text/plain" {
+		return typ
+	}
+	if byExt := ByExt(name); byExt != "" {
+		return byExt
+	}
+	return typ
+}
+
+// File is the Type of filename, reading its head.
+func File(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	head, err := Head(file)
+	if err != nil {
+		return "", err
+	}
+	return Type(filename, head), nil
+}
+
+// Head reads the start of reader detection looks at.
+func Head(reader io.Reader) ([]byte, error) {
+	head := make([]byte, HeadSize)
+	n, err := io.ReadFull(reader, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return head[:n], err
+}
+
+// extensions are the types of extensions the mime package may not know.
+var extensions = map[string]string{
+	".mp4":  MP4,
+	".m4v":  MP4,
+	".mov":  QuickTime,
+	".webm": WebM,
+	".mkv":  Matroska,
+	".heic": HEIC,
+	".heif": HEIF,
+	".avif": AVIF,
+	".cr3":  "image/x-canon-cr3",
+	".m4a":  M4A,
+	".ogg":  OGG,
+	".oga":  OGG,
+	".opus": OGG,
+	".flac": FLAC,
+	".zip":  Zip,
+	".tar":  Tar,
+	".gz":   Gzip,
+	".tgz":  Gzip,
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".mp3":  "audio/mpeg",
+}
+
+// ByExt is the media type of name's extension (case-insensitive), "" if it's unknown.
+func ByExt(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if typ, ok := extensions[ext]; ok {
+		return typ
+	}
+	typ, _, _ := strings.Cut(mime.TypeByExtension(ext), ";")
+	return typ
+}
+
+// signature detects the formats http.DetectContentType doesn't (or gets wrong), "" if none matches.
+func signature(head []byte) string {
+	switch {
+	case len(head) >= 12 && bytes.Equal(head[4:8], []byte("ftyp")):
+		return ftyp(string(head[8:12]))
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		// EBML, the doctype tells WebM from Matroska.
+		if bytes.Contains(head, []byte("webm")) {
+			return WebM
+		}
+		return Matroska
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return OGG
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return FLAC
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return Zip
+	case bytes.HasPrefix(head, []byte{0x1F, 0x8B}):
+		return Gzip
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return Tar
+	}
+	return ""
+}
+
+// ftyp is the type of an ISO media file by its major brand, Unknown for the brands that don't tell (or
+// aren't video, e.g. CR3 raw photos, JPEG 2000).
+func ftyp(brand string) string {
+	switch brand {
+	case "heic", "heix", "hevc", "hevx", "heim", "heis":
+		return HEIC
+	case "mif1", "msf1":
+		return HEIF
+	case "avif", "avis":
+		return AVIF
+	case "qt  ":
+		return QuickTime
+	case "M4A ", "M4B ":
+		return M4A
+	case "isom", "iso2", "iso3", "iso4", "iso5", "iso6", "mp41", "mp42", "mmp4", "avc1", "M4V ", "M4VH", "M4VP",
+		"f4v ", "dash", "MSNV", "XAVC":
+		return MP4
+	}
+	if strings.HasPrefix(brand, "3gp") || strings.HasPrefix(brand, "3g2") {
+		return MP4
+	}
+	return Unknown
+}
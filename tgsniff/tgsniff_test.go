@@ -0,0 +1,49 @@
+package tgsniff
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+)
+
+func TestType(t *testing.T) {
+	t.Parallel()
+
+	tarball := &bytes.Buffer{}
+	writer := tar.NewWriter(tarball)
+	if err := writer.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0644, Size: 1}); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = writer.Write([]byte("a"))
+	_ = writer.Close()
+
+	for _, test := range []struct {
+		name     string
+		head     []byte
+		expected string
+	}{
+		{"IMG_1234", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), HEIC},
+		{"video.bin", []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00"), MP4},
+		{"clip.mp4", []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00"), QuickTime},
+		{"phone.bin", []byte("\x00\x00\x00\x18ftyp3gp5\x00\x00\x00\x00"), MP4},
+		{"IMG_0001.CR3", []byte("\x00\x00\x00\x18ftypcrx \x00\x00\x00\x01"), "image/x-canon-cr3"},
+		{"frame.bin", []byte("\x00\x00\x00\x14ftypjp2 \x00\x00\x00\x00"), Unknown},
+		{"clip", []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm"), WebM},
+		{"clip.webm", []byte("\x1a\x45\xdf\xa3\xa3\x42\x86\x81\x01\x42\x82\x88matroska"), WebM},
+		{"clip.mkv", []byte("\x1a\x45\xdf\xa3\xa3\x42\x86\x81\x01\x42\x82\x88matroska"), Matroska},
+		{"voice", []byte("OggS\x00\x02"), OGG},
+		{"track", []byte("fLaC\x00\x00\x00\x22"), FLAC},
+		{"photo.jpeg", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png"},
+		{"photo.png", []byte("\xff\xd8\xff\xe0\x00\x10JFIF"), "image/jpeg"},
+		{"archive.tar.gz", []byte("\x1f\x8b\x08\x00"), Gzip},
+		{"archive.bin", []byte("PK\x03\x04\x14\x00"), Zip},
+		{"archive", tarball.Bytes()[:HeadSize], Tar},
+		{"notes.txt", []byte("hello"), "text/plain"},
+		{"clip.webm", []byte("not really"), WebM},
+		{"data.bin", []byte{0x00, 0x01, 0x02}, Unknown},
+	} {
+		if typ := Type(test.name, test.head); typ != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, typ)
+		}
+	}
+}
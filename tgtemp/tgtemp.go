@@ -0,0 +1,119 @@
+package tgtemp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Root is the directory workspaces are created in, os.TempDir() when empty.
+var Root = ""
+
+var ErrClosed = errors.New("tgtemp: workspace is closed")
+
+// Workspace is a temporary directory owning every file created through it. Close removes everything
+// synchronously, so the usual pattern is
+//
+//	ws, err := tgtemp.New(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer ws.Close()
+//
+// which also cleans up on panics. The workspace is closed when ctx is done as well.
+type Workspace struct {
+	dir string
+
+	mu     sync.Mutex
+	files  []*os.File
+	closed bool
+	stop   func() bool
+}
+
+// New creates a workspace in Root.
+func New(ctx context.Context) (*Workspace, error) {
+	return NewIn(ctx, Root)
+}
+
+// NewIn creates a workspace in root, os.TempDir() when empty.
+func NewIn(ctx context.Context, root string) (*Workspace, error) {
+	if root != "" {
+		if err := os.MkdirAll(root, 0700); err != nil {
+			return nil, err
+		}
+	}
+	dir, err := os.MkdirTemp(root, "kittenbark_tgmedia_*")
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &Workspace{dir: dir}
+	ws.stop = context.AfterFunc(ctx, func() { _ = ws.Close() })
+	return ws, nil
+}
+
+// Dir is the directory of the workspace.
+func (ws *Workspace) Dir() string {
+	return ws.dir
+}
+
+// File creates a new file in the workspace, pattern is the same as in os.CreateTemp. The file is closed
+// and removed on Close.
+func (ws *Workspace) File(pattern string) (*os.File, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return nil, ErrClosed
+	}
+
+	file, err := os.CreateTemp(ws.dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	ws.files = append(ws.files, file)
+	return file, nil
+}
+
+// Path reserves a unique file name in the workspace (for tools writing the file themselves, e.g. ffmpeg -y).
+func (ws *Workspace) Path(pattern string) (string, error) {
+	file, err := ws.File(pattern)
+	if err != nil {
+		return "", err
+	}
+	return file.Name(), file.Close()
+}
+
+// Mkdir creates a new directory in the workspace, pattern is the same as in os.MkdirTemp.
+func (ws *Workspace) Mkdir(pattern string) (string, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return "", ErrClosed
+	}
+
+	return os.MkdirTemp(ws.dir, pattern)
+}
+
+// Join returns a path inside the workspace, nothing is created.
+func (ws *Workspace) Join(elem ...string) string {
+	return filepath.Join(append([]string{ws.dir}, elem...)...)
+}
+
+// Close closes the files of the workspace and removes its directory, it's safe to call Close more than once.
+func (ws *Workspace) Close() error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return nil
+	}
+	ws.closed = true
+	ws.stop()
+
+	for _, file := range ws.files {
+		_ = file.Close()
+	}
+	ws.files = nil
+	return os.RemoveAll(ws.dir)
+}
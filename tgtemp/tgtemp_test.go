@@ -0,0 +1,65 @@
+package tgtemp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWorkspace(t *testing.T) {
+	t.Parallel()
+
+	ws, err := NewIn(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := ws.File("*.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserved, err := ws.Path("*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ws.Mkdir("unpacked_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{file.Name(), reserved, dir, ws.Dir()} {
+		if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(name, "was expected to be removed:", err)
+		}
+	}
+	if _, err := ws.File("*.mp4"); !errors.Is(err, ErrClosed) {
+		t.Fatal("ErrClosed expected, got", err)
+	}
+	if err := ws.Close(); err != nil {
+		t.Fatal("second close", err)
+	}
+}
+
+func TestWorkspace_Cancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ws, err := NewIn(ctx, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	for range 100 {
+		if _, err := os.Stat(ws.Dir()); errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("workspace wasn't removed after the context was cancelled")
+}
@@ -0,0 +1,156 @@
+package tgvideo
+
+import (
+	"context"
+	"fmt"
+	"github.com/kittenbark/tgmedia/tgcache"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Cache keeps transcoded videos and their thumbnails between calls (and processes sharing the directory),
+// so sending the same file to several chats encodes it once. Entries are keyed by the content of the input
+// and everything affecting the output: the profile, and the files it refers to. Nil disables caching.
+var Cache *tgcache.Dir
+
+const (
+	cacheVideo     = "video.mp4"
+	cacheThumbnail = "thumbnail.jpg"
+)
+
+// prepare transcodes filename and builds the thumbnail of the result, both in ws. They are taken from (or
+// put into) Cache when it's set.
+func prepare(ctx context.Context, ws *tgtemp.Workspace, filename string, profile *Profile) (converted string, thumbnail string, err error) {
+	if Cache == nil {
+		dir, err := ws.Mkdir("transcoded_*")
+		if err != nil {
+			return "", "", fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		return prepareIn(ctx, dir, filename, profile)
+	}
+
+	key, err := profile.Key(filename)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to build cache key: %w", err)
+	}
+	entry, err := Cache.Do(key, func(dir string) error {
+		_, _, err := prepareIn(ctx, dir, filename, profile)
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	// entries may be evicted by another process while being sent, the workspace keeps its own links.
+	dir, err := ws.Mkdir("cached_*")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	converted, thumbnail = filepath.Join(dir, cacheVideo), filepath.Join(dir, cacheThumbnail)
+	if err := link(filepath.Join(entry, cacheVideo), converted); err != nil {
+		return "", "", fmt.Errorf("failed to take video from cache: %w", err)
+	}
+	if err := link(filepath.Join(entry, cacheThumbnail), thumbnail); err != nil {
+		return "", "", fmt.Errorf("failed to take thumbnail from cache: %w", err)
+	}
+	return converted, thumbnail, nil
+}
+
+func prepareIn(ctx context.Context, dir string, filename string, profile *Profile) (converted string, thumbnail string, err error) {
+	converted, thumbnail = filepath.Join(dir, cacheVideo), filepath.Join(dir, cacheThumbnail)
+	if err := transcode(ctx, filename, converted, profile); err != nil {
+		return "", "", err
+	}
+	if _, err := buildThumbnail(ctx, converted, thumbnail); err != nil {
+		return "", "", err
+	}
+	return converted, thumbnail, nil
+}
+
+// link hard links filename to target, copying it when links aren't possible (e.g. another filesystem).
+func link(filename string, target string) error {
+	if err := os.Link(filename, target); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// Key identifies the result of transcoding filename with the profile: the input's content and everything
+// affecting the output. It keys Cache entries and the file ids of transcoded videos (see tgsend.FileIds).
+func (profile *Profile) Key(filename string) (string, error) {
+	input, err := tgcache.Hash(filename)
+	if err != nil {
+		return "", err
+	}
+	parts := []string{"tgvideo/1", input, "preset=" + profile.preset()}
+	if profile == nil {
+		return tgcache.Key(parts...), nil
+	}
+
+	if profile.AutoCrop {
+		parts = append(parts, fmt.Sprintf("autocrop=%d:%d", CropSamples, CropSampleSeconds))
+	}
+	if subtitles := profile.Subtitles; subtitles != nil {
+		parts = append(parts, fmt.Sprintf("subtitles=%d:%d", subtitles.Mode, subtitles.Track))
+		files := []string{subtitles.External}
+		if subtitles.External == "" {
+			base := strings.TrimSuffix(filename, filepath.Ext(filename))
+			files = []string{base + ".ass", base + ".srt"}
+		}
+		for _, file := range files {
+			hash, err := hashIfExists(file)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, "subtitles_file="+hash)
+		}
+	}
+	if overlay := profile.Overlay; overlay != nil {
+		image, err := hashIfExists(overlay.Image)
+		if err != nil {
+			return "", err
+		}
+		font, err := hashIfExists(overlay.FontFile)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts,
+			"overlay_image="+image,
+			"overlay_text="+overlay.Text,
+			"overlay_font="+font,
+			"overlay_color="+overlay.FontColor,
+			"overlay_position="+strconv.Itoa(int(overlay.Position)),
+			"overlay_geometry="+formatFloat(overlay.Margin)+":"+formatFloat(overlay.Opacity)+":"+formatFloat(overlay.Scale),
+		)
+	}
+	return tgcache.Key(parts...), nil
+}
+
+// hashIfExists hashes filename, an empty or missing one hashes to "".
+func hashIfExists(filename string) (string, error) {
+	if filename == "" {
+		return "", nil
+	}
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return "", nil
+	}
+	return tgcache.Hash(filename)
+}
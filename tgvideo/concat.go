@@ -0,0 +1,336 @@
+package tgvideo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgsend"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Chapter is the part of a concatenated video that came from one clip.
+type Chapter struct {
+	Title      string
+	Start, End time.Duration
+}
+
+type Chapters []*Chapter
+
+// String lists the chapters as timecodes, Telegram makes them clickable in a video caption.
+func (chapters Chapters) String() string {
+	lines := []string{}
+	for _, chapter := range chapters {
+		lines = append(lines, fmt.Sprintf("%s %s", formatTimecode(chapter.Start), chapter.Title))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// caption is caption followed by the chapters, as many of them as fit in Telegram's limit: the last
+// chapters are dropped, the caption is only cut when it doesn't fit by itself.
+func (chapters Chapters) caption(caption string, parseMode string) string {
+	separator := ""
+	if caption != "" {
+		separator = "\n\n"
+	}
+	lines := strings.Split(chapters.String(), "\n")
+	for n := len(lines); n > 0; n-- {
+		text := caption + separator + strings.Join(lines[:n], "\n")
+		if tgsend.CaptionLength(text, parseMode) <= tgsend.CaptionLimit {
+			return text
+		}
+	}
+	return tgsend.TruncateCaption(caption, parseMode, tgsend.CaptionLimit)
+}
+
+// SendConcat joins the videos in order and sends the result, listChapters appends the chapters to the caption.
+func SendConcat(ctx context.Context, chatId int64, filenames []string, listChapters bool, opts ...*tg.OptSendVideo) (*tg.Message, error) {
+	ctx = withChat(ctx, chatId)
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	defer ws.Close()
+
+	joined, err := ws.Path("*.mp4")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	chapters, err := concat(ctx, ws, filenames, joined)
+	if err != nil {
+		return nil, err
+	}
+
+	if listChapters {
+		opt := &tg.OptSendVideo{}
+		if len(opts) > 0 && opts[0] != nil {
+			copied := *opts[0]
+			opt = &copied
+		}
+		opt.Caption = chapters.caption(opt.Caption, opt.ParseMode)
+		opts = append([]*tg.OptSendVideo{opt}, opts[min(1, len(opts)):]...)
+	}
+
+	return send(ctx, ws, chatId, joined, filepath.Base(filenames[0]), opts...)
+}
+
+// Concat joins the videos in order into output (mp4) with a chapter per clip. When the clips share codecs and
+// parameters (e.g. dashcam exports) and the codecs are H.264 or HEVC with AAC or MP3, they're joined without
+// re-encoding, otherwise they are normalized to the size and frame rate of the first one.
+func Concat(ctx context.Context, filenames []string, output string) (Chapters, error) {
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	defer ws.Close()
+
+	return concat(ctx, ws, filenames, output)
+}
+
+func concat(ctx context.Context, ws *tgtemp.Workspace, filenames []string, output string) (Chapters, error) {
+	if len(filenames) == 0 {
+		return nil, errors.New("tgvideo: nothing to concatenate")
+	}
+
+	clips := []*clip{}
+	for _, filename := range filenames {
+		c, err := probeClip(ctx, filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file metadata %s: %w", filename, err)
+		}
+		clips = append(clips, c)
+	}
+
+	chapters := Chapters{}
+	start := time.Duration(0)
+	for _, c := range clips {
+		title := strings.TrimSuffix(filepath.Base(c.filename), filepath.Ext(c.filename))
+		chapters = append(chapters, &Chapter{Title: title, Start: start, End: start + c.duration})
+		start += c.duration
+	}
+
+	metadataFile, err := ws.Path("chapters_*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	if err := os.WriteFile(metadataFile, []byte(chapters.ffmetadata()), 0666); err != nil {
+		return nil, err
+	}
+
+	var args []string
+	if sameParameters(clips) && clips[0].copyable() {
+		args, err = concatCopyArgs(ws, clips, metadataFile, output)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		args = concatEncodeArgs(clips, metadataFile, output)
+	}
+
+	stdout, stderr, err := run(ctx, nil, Ffmpeg, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to concatenate videos: %w (stdout: %s, stderr: %s)", err, stdout, stderr)
+	}
+	return chapters, nil
+}
+
+// clip is what concatenation needs to know about a video.
+type clip struct {
+	filename string
+	duration time.Duration
+	width    int64
+	height   int64
+	hasAudio bool
+	// videoCodec and audioCodec are the codecs of the first streams, audioCodec is "" without audio.
+	videoCodec string
+	audioCodec string
+	// signature are the codec parameters, clips with equal signatures can be joined by the concat demuxer.
+	signature string
+	frameRate string
+}
+
+func probeClip(ctx context.Context, filename string) (*clip, error) {
+	type fileStreams struct {
+		Streams []struct {
+			CodecType  string `json:"codec_type"`
+			CodecName  string `json:"codec_name"`
+			Width      int64  `json:"width"`
+			Height     int64  `json:"height"`
+			PixFmt     string `json:"pix_fmt"`
+			FrameRate  string `json:"r_frame_rate"`
+			SampleRate string `json:"sample_rate"`
+			Channels   int    `json:"channels"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+
+	output, _, err := run(ctx, nil, Ffprobe, "-v", "error", "-show_entries",
+		"stream=codec_type,codec_name,width,height,pix_fmt,r_frame_rate,sample_rate,channels:format=duration",
+		"-of", "json", filename)
+	if err != nil {
+		return nil, fmt.Errorf("%v\n%s", err, output)
+	}
+	var streams fileStreams
+	if err := json.Unmarshal([]byte(output), &streams); err != nil {
+		return nil, fmt.Errorf("%v\n%s", err, output)
+	}
+
+	duration, _ := strconv.ParseFloat(streams.Format.Duration, 64)
+	result := &clip{filename: filename, duration: time.Duration(duration * float64(time.Second))}
+	signature := []string{}
+	for _, stream := range streams.Streams {
+		switch stream.CodecType {
+		case "video":
+			if result.width != 0 {
+				continue
+			}
+			result.width, result.height, result.frameRate = stream.Width, stream.Height, stream.FrameRate
+			result.videoCodec = stream.CodecName
+			signature = append(signature, fmt.Sprintf("v:%s:%dx%d:%s:%s", stream.CodecName, stream.Width, stream.Height, stream.PixFmt, stream.FrameRate))
+		case "audio":
+			if result.hasAudio {
+				continue
+			}
+			result.hasAudio, result.audioCodec = true, stream.CodecName
+			signature = append(signature, fmt.Sprintf("a:%s:%s:%d", stream.CodecName, stream.SampleRate, stream.Channels))
+		}
+	}
+	if result.width == 0 {
+		return nil, errors.New("no video stream")
+	}
+	result.signature = strings.Join(signature, ";")
+	return result, nil
+}
+
+func sameParameters(clips []*clip) bool {
+	for _, c := range clips[1:] {
+		if c.signature != clips[0].signature {
+			return false
+		}
+	}
+	return true
+}
+
+// The codecs an mp4 takes as they are and Telegram plays, clips in others are re-encoded.
+var (
+	copyVideoCodecs = []string{"h264", "hevc"}
+	copyAudioCodecs = []string{"aac", "mp3"}
+)
+
+// copyable tells whether the streams of c can be copied into the mp4 sent, without re-encoding.
+func (c *clip) copyable() bool {
+	return slices.Contains(copyVideoCodecs, c.videoCodec) &&
+		(!c.hasAudio || slices.Contains(copyAudioCodecs, c.audioCodec))
+}
+
+func concatCopyArgs(ws *tgtemp.Workspace, clips []*clip, metadataFile string, output string) ([]string, error) {
+	list := strings.Builder{}
+	for _, c := range clips {
+		filename, err := filepath.Abs(c.filename)
+		if err != nil {
+			return nil, err
+		}
+		list.WriteString(fmt.Sprintf("file '%s'\n", strings.ReplaceAll(filename, "'", `'\''`)))
+	}
+	listFile, err := ws.Path("list_*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	if err := os.WriteFile(listFile, []byte(list.String()), 0666); err != nil {
+		return nil, err
+	}
+
+	return []string{
+		"-y",
+		"-f", "concat", "-safe", "0", "-i", listFile,
+		"-i", metadataFile,
+		"-map", "0:v", "-map", "0:a?",
+		"-map_metadata", "1", "-map_chapters", "1",
+		"-c", "copy",
+		"-movflags", "+faststart",
+		output,
+	}, nil
+}
+
+func concatEncodeArgs(clips []*clip, metadataFile string, output string) []string {
+	width, height := clips[0].width&^1, clips[0].height&^1
+	frameRate := clips[0].frameRate
+	if frameRate == "" || frameRate == "0/0" {
+		frameRate = "30"
+	}
+	withAudio := false
+	for _, c := range clips {
+		withAudio = withAudio || c.hasAudio
+	}
+
+	args := []string{"-y"}
+	chains := []string{}
+	joined := strings.Builder{}
+	for i, c := range clips {
+		args = append(args, "-i", c.filename)
+		chains = append(chains, fmt.Sprintf(
+			"[%[1]d:v]scale=%[2]d:%[3]d:force_original_aspect_ratio=decrease,pad=%[2]d:%[3]d:(ow-iw)/2:(oh-ih)/2:color=black,setsar=1,fps=%[4]s,format=yuv420p[v%[1]d]",
+			i, width, height, frameRate,
+		))
+		joined.WriteString(fmt.Sprintf("[v%d]", i))
+		if !withAudio {
+			continue
+		}
+		if c.hasAudio {
+			chains = append(chains, fmt.Sprintf("[%[1]d:a]aresample=48000,aformat=channel_layouts=stereo[a%[1]d]", i))
+		} else {
+			chains = append(chains, fmt.Sprintf("anullsrc=r=48000:cl=stereo,atrim=end=%s[a%d]", formatFloat(c.duration.Seconds()), i))
+		}
+		joined.WriteString(fmt.Sprintf("[a%d]", i))
+	}
+
+	maps := []string{"-map", "[v]"}
+	if withAudio {
+		maps = append(maps, "-map", "[a]")
+		chains = append(chains, fmt.Sprintf("%sconcat=n=%d:v=1:a=1[v][a]", joined.String(), len(clips)))
+	} else {
+		chains = append(chains, fmt.Sprintf("%sconcat=n=%d:v=1:a=0[v]", joined.String(), len(clips)))
+	}
+
+	args = append(args, "-i", metadataFile, "-filter_complex", strings.Join(chains, ";"))
+	args = append(args, maps...)
+	return append(args,
+		"-map_metadata", strconv.Itoa(len(clips)), "-map_chapters", strconv.Itoa(len(clips)),
+		"-c:v", "libx264",
+		"-preset", Preset,
+		"-c:a", "aac",
+		"-movflags", "+faststart",
+		output,
+	)
+}
+
+// ffmetadata renders the chapters in ffmpeg's metadata file format.
+func (chapters Chapters) ffmetadata() string {
+	escape := strings.NewReplacer(`\`, `\\`, `=`, `\=`, `;`, `\;`, `#`, `\#`, "\n", "\\\n")
+	result := strings.Builder{}
+	result.WriteString(";FFMETADATA1\n")
+	for _, chapter := range chapters {
+		result.WriteString(fmt.Sprintf(
+			"[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			chapter.Start.Milliseconds(), chapter.End.Milliseconds(), escape.Replace(chapter.Title),
+		))
+	}
+	return result.String()
+}
+
+func formatTimecode(d time.Duration) string {
+	seconds := int64(d.Seconds())
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
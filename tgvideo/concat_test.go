@@ -0,0 +1,60 @@
+package tgvideo
+
+import (
+	"fmt"
+	"github.com/kittenbark/tgmedia/tgsend"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChapters(t *testing.T) {
+	t.Parallel()
+
+	chapters := Chapters{
+		{Title: "first", Start: 0, End: time.Minute},
+		{Title: "second=2; #3", Start: time.Minute, End: time.Hour + 90*time.Second},
+		{Title: "third", Start: time.Hour + 90*time.Second, End: 2 * time.Hour},
+	}
+	if s := chapters.String(); s != "00:00 first\n01:00 second=2; #3\n1:01:30 third" {
+		t.Fatal("unexpected caption", s)
+	}
+
+	expected := ";FFMETADATA1\n" +
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=60000\ntitle=first\n" +
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=60000\nEND=3690000\ntitle=second\\=2\\; \\#3\n" +
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=3690000\nEND=7200000\ntitle=third\n"
+	if s := chapters.ffmetadata(); s != expected {
+		t.Fatal("unexpected metadata", s)
+	}
+}
+
+func TestSendConcat(t *testing.T) {
+	t.Parallel()
+
+	if _, err := SendConcat(bot.Context(), chat, []string{"./video.mp4", "./video.mp4", "./letterboxed.mp4"}, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChapters_Caption(t *testing.T) {
+	t.Parallel()
+
+	chapters := Chapters{}
+	for i := range 60 {
+		start := time.Duration(i) * time.Minute
+		chapters = append(chapters, &Chapter{Title: fmt.Sprintf("dashcam_2024-06-01_%02d-00", i), Start: start, End: start + time.Minute})
+	}
+	caption := chapters.caption("<b>Road trip</b>", "HTML")
+	if n := tgsend.CaptionLength(caption, "HTML"); n > tgsend.CaptionLimit {
+		t.Fatal("caption over the limit", n)
+	}
+	if !strings.HasPrefix(caption, "<b>Road trip</b>\n\n00:00 dashcam_2024-06-01_00-00\n") || strings.HasSuffix(caption, "…") {
+		t.Fatal("expected the caption kept and the last chapters dropped", caption)
+	}
+
+	clips := []*clip{{videoCodec: "h264", hasAudio: true, audioCodec: "aac"}, {videoCodec: "vp9"}, {videoCodec: "h264", hasAudio: true, audioCodec: "pcm_s16le"}}
+	if !clips[0].copyable() || clips[1].copyable() || clips[2].copyable() {
+		t.Fatal("expected only h264 with aac copied")
+	}
+}
@@ -0,0 +1,101 @@
+package tgvideo
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Crop is a rectangle of the frame to keep.
+type Crop struct {
+	Width, Height int64
+	X, Y          int64
+}
+
+var (
+	// CropSamples is the number of segments spread over the video that cropdetect looks at.
+	CropSamples = 5
+	// CropSampleSeconds is the length of each sampled segment.
+	CropSampleSeconds = 2
+)
+
+var cropdetectRegexp = regexp.MustCompile(`crop=(\d+):(\d+):(\d+):(\d+)`)
+
+// DetectCrop finds the black bars of a video running ffmpeg's cropdetect over several segments of it. The
+// result covers whatever any segment considered picture, so a dark scene doesn't cut off the content of
+// others. A nil result means there is nothing to crop.
+func DetectCrop(ctx context.Context, filename string) (*Crop, error) {
+	meta, err := getFileMetadata(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file metadata: %w", err)
+	}
+	if meta.Width == 0 || meta.Height == 0 {
+		return nil, nil
+	}
+
+	var result *Crop
+	for i := range CropSamples {
+		offset := meta.Duration * int64(2*i+1) / int64(2*CropSamples)
+		_, stderr, err := run(
+			ctx, nil, Ffmpeg,
+			"-ss", strconv.FormatInt(offset, 10),
+			"-i", filename,
+			"-t", strconv.Itoa(CropSampleSeconds),
+			"-vf", "cropdetect=limit=24:round=2:reset=0",
+			"-an", "-f", "null", "-",
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect crop: %w (stderr: %s)", err, stderr)
+		}
+
+		crop := parseCropdetect(stderr)
+		if crop == nil {
+			continue
+		}
+		result = result.union(crop)
+	}
+
+	if result == nil || (result.Width >= meta.Width && result.Height >= meta.Height) {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// parseCropdetect returns the last rectangle cropdetect reported, it's the settled one with reset=0.
+func parseCropdetect(output string) *Crop {
+	matches := cropdetectRegexp.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	last := matches[len(matches)-1]
+	values := [4]int64{}
+	for i := range values {
+		values[i], _ = strconv.ParseInt(last[i+1], 10, 64)
+	}
+	if values[0] <= 0 || values[1] <= 0 {
+		return nil
+	}
+	return &Crop{Width: values[0], Height: values[1], X: values[2], Y: values[3]}
+}
+
+// union returns the smallest rectangle containing both crop and other, the sides are kept even for libx264.
+func (crop *Crop) union(other *Crop) *Crop {
+	if crop == nil {
+		return other
+	}
+
+	left, top := min(crop.X, other.X), min(crop.Y, other.Y)
+	right, bottom := max(crop.X+crop.Width, other.X+other.Width), max(crop.Y+crop.Height, other.Y+other.Height)
+	return &Crop{
+		Width:  (right - left) &^ 1,
+		Height: (bottom - top) &^ 1,
+		X:      left,
+		Y:      top,
+	}
+}
+
+func (crop *Crop) draw(g *graph) {
+	g.filter(fmt.Sprintf("crop=%d:%d:%d:%d", crop.Width, crop.Height, crop.X, crop.Y))
+}
@@ -0,0 +1,37 @@
+package tgvideo
+
+import "testing"
+
+func TestParseCropdetect(t *testing.T) {
+	t.Parallel()
+
+	output := `[Parsed_cropdetect_0 @ 0x1] x1:0 x2:1919 y1:138 y2:941 w:1920 h:800 x:0 y:140 pts:1 t:0.04 crop=1920:800:0:140
+[Parsed_cropdetect_0 @ 0x1] x1:0 x2:1919 y1:132 y2:947 w:1920 h:816 x:0 y:132 pts:2 t:0.08 crop=1920:816:0:132`
+	crop := parseCropdetect(output)
+	if crop == nil || *crop != (Crop{Width: 1920, Height: 816, X: 0, Y: 132}) {
+		t.Fatal("unexpected crop", crop)
+	}
+
+	if crop := parseCropdetect("no cropdetect here"); crop != nil {
+		t.Fatal("no crop expected", crop)
+	}
+}
+
+func TestCropUnion(t *testing.T) {
+	t.Parallel()
+
+	var crop *Crop
+	crop = crop.union(&Crop{Width: 1920, Height: 800, X: 0, Y: 140})
+	crop = crop.union(&Crop{Width: 1800, Height: 816, X: 60, Y: 132})
+	if *crop != (Crop{Width: 1920, Height: 816, X: 0, Y: 132}) {
+		t.Fatal("unexpected union", crop)
+	}
+}
+
+func TestSendTranscoded_AutoCrop(t *testing.T) {
+	t.Parallel()
+
+	if _, err := SendTranscoded(bot.Context(), chat, "./letterboxed.mp4", &Profile{AutoCrop: true}); err != nil {
+		t.Fatal(err)
+	}
+}
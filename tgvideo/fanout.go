@@ -0,0 +1,47 @@
+package tgvideo
+
+import (
+	"context"
+	"fmt"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgsend"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"path/filepath"
+)
+
+// SendFanout is Send to every target: the video is uploaded once and copied to the other chats, see
+// tgsend.Fanout.
+func SendFanout(ctx context.Context, targets []*tgsend.Target, filename string, opts ...*tg.OptSendVideo) []*tgsend.FanoutResult {
+	if len(targets) > 0 {
+		ctx = withChat(ctx, targets[0].ChatId)
+	}
+	return tgsend.Fanout(ctx, targets, func(ctx context.Context, target *tgsend.Target) ([]*tg.Message, error) {
+		msg, err := Send(ctx, target.ChatId, filename, tgsend.TargetOpts(opts, target, func(opt *tg.OptSendVideo) (*int64, *bool) { return &opt.MessageThreadId, &opt.DisableNotification })...)
+		return []*tg.Message{msg}, err
+	})
+}
+
+// SendTranscodedFanout is SendTranscoded to every target: the video is transcoded and uploaded once, and
+// copied to the other chats, see tgsend.Fanout. Extracted subtitles are copied too, though the copies
+// aren't replies to the video.
+func SendTranscodedFanout(ctx context.Context, targets []*tgsend.Target, filename string, profile *Profile, opts ...*tg.OptSendVideo) []*tgsend.FanoutResult {
+	if len(targets) == 0 {
+		return nil
+	}
+	ctx = withChat(ctx, targets[0].ChatId)
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to create workspace: %w", err)
+		results := []*tgsend.FanoutResult{}
+		for _, target := range targets {
+			results = append(results, &tgsend.FanoutResult{Target: target, Err: err})
+		}
+		return results
+	}
+	defer ws.Close()
+
+	return tgsend.Fanout(ctx, targets, func(ctx context.Context, target *tgsend.Target) ([]*tg.Message, error) {
+		msg, subtitles, err := sendTranscoded(ctx, ws, target.ChatId, filename, filepath.Base(filename), profile, tgsend.TargetOpts(opts, target, func(opt *tg.OptSendVideo) (*int64, *bool) { return &opt.MessageThreadId, &opt.DisableNotification })...)
+		return append([]*tg.Message{msg}, subtitles...), err
+	})
+}
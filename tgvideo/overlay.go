@@ -0,0 +1,140 @@
+package tgvideo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Position is a corner (or the center) of the frame an Overlay is anchored to.
+type Position int
+
+const (
+	BottomRight Position = iota
+	BottomLeft
+	TopRight
+	TopLeft
+	Center
+)
+
+// Overlay is a watermark drawn on top of a video or a picture: either an image (a logo, usually a png
+// with alpha) or a text. Sizes are relative to the frame, so the same overlay fits any resolution.
+type Overlay struct {
+	// Image is a path to the watermark picture, Text is used when it's empty.
+	Image string
+	Text  string
+	// FontFile is a path to a ttf/otf font for Text, ffmpeg's default font is used when empty.
+	FontFile string
+	// FontColor is an ffmpeg color for Text, e.g. "white" (default) or "#ffcc00".
+	FontColor string
+
+	Position Position
+	// Margin is the distance from the frame edges as a fraction of the frame's shorter side.
+	Margin float64
+	// Opacity is in (0, 1], zero means fully opaque.
+	Opacity float64
+	// Scale is the watermark width (Image) or the text height (Text) as a fraction of the frame
+	// width/height, zero means 0.2 for images and 0.05 for texts.
+	Scale float64
+}
+
+// OverlayImage draws overlay on top of the picture filename and writes the result to output (jpeg is
+// expected, the format follows output's extension).
+func OverlayImage(ctx context.Context, filename string, output string, overlay *Overlay) error {
+	g := newGraph()
+	overlay.draw(g)
+
+	args := []string{"-y", "-i", filename}
+	args = append(args, g.args()...)
+	args = append(args, "-map", g.output(), "-frames:v", "1", "-q:v", "2", output)
+
+	stdout, stderr, err := run(ctx, nil, Ffmpeg, args...)
+	if err != nil {
+		return fmt.Errorf("failed to draw overlay: %w (stdout: %s, stderr: %s)", err, stdout, stderr)
+	}
+	return nil
+}
+
+// draw adds the overlay on top of the current stream of g.
+func (overlay *Overlay) draw(g *graph) {
+	if overlay.Image != "" {
+		overlay.drawImage(g)
+		return
+	}
+	overlay.drawText(g)
+}
+
+func (overlay *Overlay) drawImage(g *graph) {
+	scale := overlay.Scale
+	if scale <= 0 {
+		scale = 0.2
+	}
+
+	frame, watermark := g.last, g.input(overlay.Image)
+	faded, scaled, base, out := g.label(), g.label(), g.label(), g.label()
+	g.chain(fmt.Sprintf("[%s]format=rgba,colorchannelmixer=aa=%s[%s]", watermark, formatFloat(overlay.opacity()), faded), faded)
+	g.chain(
+		fmt.Sprintf("[%s][%s]scale2ref=w=main_w*%s:h=ow/dar[%s][%s]", faded, frame, formatFloat(scale), scaled, base),
+		base,
+	)
+	x, y := overlay.position("main_w", "main_h", "overlay_w", "overlay_h")
+	g.chain(fmt.Sprintf("[%s][%s]overlay=x=%s:y=%s:format=auto[%s]", base, scaled, x, y, out), out)
+}
+
+func (overlay *Overlay) drawText(g *graph) {
+	scale := overlay.Scale
+	if scale <= 0 {
+		scale = 0.05
+	}
+	color := overlay.FontColor
+	if color == "" {
+		color = "white"
+	}
+
+	x, y := overlay.position("w", "h", "text_w", "text_h")
+	filter := fmt.Sprintf(
+		"drawtext=expansion=none:text=%s:fontcolor=%s@%s:fontsize=h*%s:borderw=1:bordercolor=black@%s:x=%s:y=%s",
+		escapeFilterValue(overlay.Text),
+		escapeFilterValue(color),
+		formatFloat(overlay.opacity()),
+		formatFloat(scale),
+		formatFloat(overlay.opacity()/2),
+		x, y,
+	)
+	if overlay.FontFile != "" {
+		filter += ":fontfile=" + escapeFilterValue(overlay.FontFile)
+	}
+	g.filter(filter)
+}
+
+func (overlay *Overlay) opacity() float64 {
+	if overlay.Opacity <= 0 || overlay.Opacity > 1 {
+		return 1
+	}
+	return overlay.Opacity
+}
+
+// position returns x/y expressions placing a w*h box inside a frameW*frameH frame, the names are
+// whatever variables the filter at hand calls them.
+func (overlay *Overlay) position(frameW, frameH, w, h string) (x string, y string) {
+	margin := fmt.Sprintf("min(%s\\,%s)*%s", frameW, frameH, formatFloat(overlay.Margin))
+	left, right := margin, fmt.Sprintf("%s-%s-%s", frameW, w, margin)
+	top, bottom := margin, fmt.Sprintf("%s-%s-%s", frameH, h, margin)
+
+	switch overlay.Position {
+	case BottomLeft:
+		return left, bottom
+	case TopRight:
+		return right, top
+	case TopLeft:
+		return left, top
+	case Center:
+		return fmt.Sprintf("(%s-%s)/2", frameW, w), fmt.Sprintf("(%s-%s)/2", frameH, h)
+	default:
+		return right, bottom
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,140 @@
+package tgvideo
+
+import (
+	"context"
+	"fmt"
+	"github.com/kittenbark/tgmedia/tgexec"
+	"strings"
+)
+
+// Profile describes how a video is transcoded to H264 before sending. A nil *Profile encodes with
+// the package defaults (Preset, no filters), that's what SendH264 and NewH264 do.
+type Profile struct {
+	// Preset is the libx264 preset, the package-level Preset is used when empty.
+	Preset string
+	// AutoCrop cuts off black bars (see DetectCrop), the video is sent with the cropped width and height.
+	AutoCrop bool
+	// Subtitles are burned into the picture or sent along with the video, they're dropped when nil.
+	Subtitles *Subtitles
+	// Overlay is drawn on top of every frame, and so on the thumbnail built from the result.
+	Overlay *Overlay
+	// Scheduler limits the transcoding processes of the profile, the package-level Scheduler is used when nil.
+	Scheduler *tgexec.Scheduler
+}
+
+func (profile *Profile) scheduler() *tgexec.Scheduler {
+	if profile == nil || profile.Scheduler == nil {
+		return Scheduler
+	}
+	return profile.Scheduler
+}
+
+func (profile *Profile) preset() string {
+	if profile == nil || profile.Preset == "" {
+		return Preset
+	}
+	return profile.Preset
+}
+
+// args builds the ffmpeg command line transcoding filename into output.
+func (profile *Profile) args(ctx context.Context, filename string, output string) ([]string, error) {
+	args := []string{"-y", "-i", filename}
+
+	g := newGraph()
+	if profile != nil && profile.AutoCrop {
+		crop, err := DetectCrop(ctx, filename)
+		if err != nil {
+			return nil, err
+		}
+		if crop != nil {
+			crop.draw(g)
+		}
+	}
+	if profile != nil && profile.Subtitles != nil {
+		if err := profile.Subtitles.draw(ctx, g, filename); err != nil {
+			return nil, err
+		}
+	}
+	if profile != nil && profile.Overlay != nil {
+		profile.Overlay.draw(g)
+	}
+	if !g.empty() {
+		args = append(args, g.args()...)
+		args = append(args, "-map", g.output(), "-map", "0:a?")
+	}
+
+	return append(args,
+		"-c:v", "libx264",
+		"-preset", profile.preset(),
+		"-c:a", "aac",
+		"-strict", "experimental",
+		output,
+	), nil
+}
+
+// extractsSubtitles reports whether subtitles should be sent as documents along with the video.
+func (profile *Profile) extractsSubtitles() bool {
+	return profile != nil && profile.Subtitles != nil && profile.Subtitles.Mode == SubtitlesExtract
+}
+
+// graph is a linear ffmpeg filter graph over the first video stream of input 0, extra inputs
+// (e.g. a watermark image) are numbered from 1 in the order they were added.
+type graph struct {
+	inputs []string
+	chains []string
+	last   string
+	labels int
+}
+
+func newGraph() *graph {
+	return &graph{last: "0:v"}
+}
+
+// input adds filename as an extra ffmpeg input and returns its stream specifier.
+func (g *graph) input(filename string) string {
+	g.inputs = append(g.inputs, filename)
+	return fmt.Sprintf("%d:v", len(g.inputs))
+}
+
+// label returns a new unique label for an intermediate stream.
+func (g *graph) label() string {
+	g.labels++
+	return fmt.Sprintf("s%d", g.labels)
+}
+
+// filter applies a single-input filter to the current stream.
+func (g *graph) filter(filter string) {
+	out := g.label()
+	g.chain(fmt.Sprintf("[%s]%s[%s]", g.last, filter, out), out)
+}
+
+// chain adds an arbitrary chain, whose output labelled out becomes the current stream.
+func (g *graph) chain(chain string, out string) {
+	g.chains = append(g.chains, chain)
+	g.last = out
+}
+
+// output returns the -map specifier of the current stream.
+func (g *graph) output() string {
+	return fmt.Sprintf("[%s]", g.last)
+}
+
+func (g *graph) empty() bool {
+	return len(g.chains) == 0
+}
+
+// args returns the extra inputs and the -filter_complex argument, the result is mapped via g.output().
+func (g *graph) args() []string {
+	args := []string{}
+	for _, input := range g.inputs {
+		args = append(args, "-i", input)
+	}
+	return append(args, "-filter_complex", strings.Join(g.chains, ";"))
+}
+
+// escapeFilterValue escapes s to be used as a filter option value inside a filter graph: once for
+// the option parser and once more for the graph parser.
+func escapeFilterValue(s string) string {
+	option := strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(s)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(option)
+}
@@ -0,0 +1,173 @@
+package tgvideo
+
+import (
+	"context"
+	"fmt"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// streamable are the containers ffmpeg can decode from a pipe, mp4/mov may keep their index at the end
+// and need seeking.
+var streamable = map[string]bool{
+	".webm": true,
+	".mkv":  true,
+	".ts":   true,
+	".flv":  true,
+}
+
+// SendReader sends the video read from reader, name is the file name shown in Telegram (its extension
+// is a hint for ffmpeg too). The video is spooled to a workspace, both ffprobe and the upload need it.
+func SendReader(ctx context.Context, chatId int64, reader io.Reader, name string, opts ...*tg.OptSendVideo) (*tg.Message, error) {
+	ctx = withChat(ctx, chatId)
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	defer ws.Close()
+
+	spooled, err := spool(ws, reader, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return send(ctx, ws, chatId, spooled, name, opts...)
+}
+
+// SendReaderTranscoded is SendTranscoded for a reader. The reader is piped into ffmpeg directly when the
+// container allows it and the profile doesn't need to look at the source twice (AutoCrop, Subtitles).
+func SendReaderTranscoded(ctx context.Context, chatId int64, reader io.Reader, name string, profile *Profile, opts ...*tg.OptSendVideo) (*tg.Message, error) {
+	ctx = withChat(ctx, chatId)
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	defer ws.Close()
+
+	if !streamable[strings.ToLower(filepath.Ext(name))] || profile.needsFile() {
+		spooled, err := spool(ws, reader, name)
+		if err != nil {
+			return nil, err
+		}
+		msg, _, err := sendTranscoded(ctx, ws, chatId, spooled, name, profile, opts...)
+		return msg, err
+	}
+
+	converted, err := ws.Path("*.mp4")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	if err := transcodeReader(ctx, reader, converted, profile); err != nil {
+		return nil, err
+	}
+
+	return send(ctx, ws, chatId, converted, name, opts...)
+}
+
+// SendURL downloads the video and sends it, see SendReader.
+func SendURL(ctx context.Context, chatId int64, rawUrl string, opts ...*tg.OptSendVideo) (*tg.Message, error) {
+	body, name, err := download(ctx, rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return SendReader(ctx, chatId, body, name, opts...)
+}
+
+// NewFromReader is New for a reader, cleanup removes the spooled copy as well.
+func NewFromReader(ctx context.Context, reader io.Reader, name string) (video *tg.Video, cleanup func(), err error) {
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		return nil, func() {}, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	cleanup = func() { _ = ws.Close() }
+
+	spooled, err := spool(ws, reader, name)
+	if err != nil {
+		defer cleanup()
+		return nil, func() {}, err
+	}
+	video, err = NewIn(ctx, ws, spooled)
+	if err != nil {
+		defer cleanup()
+		return nil, func() {}, err
+	}
+	video.Media = tg.FromDisk(spooled, name)
+	return video, cleanup, nil
+}
+
+// NewFromURL downloads the video for an album, cleanup removes the downloaded copy as well.
+func NewFromURL(ctx context.Context, rawUrl string) (*tg.Video, func(), error) {
+	body, name, err := download(ctx, rawUrl)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	defer body.Close()
+
+	return NewFromReader(ctx, body, name)
+}
+
+// needsFile reports whether the profile reads the source more than once, so it can't be piped.
+func (profile *Profile) needsFile() bool {
+	return profile != nil && (profile.AutoCrop || profile.Subtitles != nil)
+}
+
+// spool copies reader to a file in ws with the extension of name.
+func spool(ws *tgtemp.Workspace, reader io.Reader, name string) (string, error) {
+	file, err := ws.File("*" + filepath.Ext(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	if _, err := io.Copy(file, reader); err != nil {
+		return "", fmt.Errorf("failed to spool video: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return "", fmt.Errorf("failed to spool video: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// download starts fetching rawUrl, name is the last path element of the url.
+func download(ctx context.Context, rawUrl string) (body io.ReadCloser, name string, err error) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, "", err
+	}
+	name = path.Base(parsed.Path)
+	if name == "." || name == "/" {
+		name = "video.mp4"
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, "", err
+	}
+	if response.StatusCode != http.StatusOK {
+		_ = response.Body.Close()
+		return nil, "", fmt.Errorf("failed to download %s: %s", rawUrl, response.Status)
+	}
+	return response.Body, name, nil
+}
+
+func transcodeReader(ctx context.Context, reader io.Reader, converted string, profile *Profile) error {
+	args, err := profile.args(ctx, "pipe:0", converted)
+	if err != nil {
+		return err
+	}
+	stdout, stderr, err := runScheduled(ctx, profile.scheduler(), reader, Ffmpeg, args...)
+	if err != nil {
+		return fmt.Errorf("failed to convert video to H264: %w (stdout: %s, stderr: %s)", err, stdout, stderr)
+	}
+	return nil
+}
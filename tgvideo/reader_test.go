@@ -0,0 +1,56 @@
+package tgvideo
+
+import (
+	"github.com/kittenbark/tg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestSendReader(t *testing.T) {
+	t.Parallel()
+
+	file, err := os.Open("./video.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	msg, err := SendReader(bot.Context(), chat, file, "from_reader.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Video.FileName != "from_reader.mp4" {
+		t.Fatal(msg.Video.FileName, " != from_reader.mp4")
+	}
+}
+
+func TestNewFromURL(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.FileServer(http.Dir(".")))
+	defer server.Close()
+
+	vid, cleanup, err := NewFromURL(bot.Context(), server.URL+"/video.mp4")
+	defer cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := NewFromURL(bot.Context(), server.URL+"/missing.mp4"); err == nil {
+		t.Fatal("an error was expected, the file doesn't exist")
+	}
+
+	msg, err := SendURL(bot.Context(), chat, server.URL+"/video.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Video.FileName != "video.mp4" {
+		t.Fatal(msg.Video.FileName, " != video.mp4")
+	}
+
+	if _, err := tg.SendMediaGroup(bot.Context(), chat, tg.Album{vid}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,122 @@
+package tgvideo
+
+import (
+	"context"
+	"github.com/kittenbark/tgmedia/tgcache"
+	"github.com/kittenbark/tgmedia/tgexec"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestRunner isn't parallel: it swaps the package-level Runner.
+func TestRunner(t *testing.T) {
+	recorder := &tgexec.Recorder{Respond: func(ctx context.Context, cmd *tgexec.Command) error {
+		switch {
+		case cmd.Name == Ffprobe && slices.Contains(cmd.Args, "./video.mp4"):
+			_, err := io.WriteString(cmd.Stdout, `{"streams": [{"codec_type": "video", "width": 1920, "height": 1080}], "format": {"duration": "10.5"}}`)
+			return err
+		case cmd.Name == Ffprobe:
+			_, err := io.WriteString(cmd.Stdout, `{"streams": [{"codec_type": "video", "width": 1920, "height": 800}], "format": {"duration": "10.5"}}`)
+			return err
+		case slices.Contains(cmd.Args, "null"):
+			_, err := io.WriteString(cmd.Stderr, "[Parsed_cropdetect_0 @ 0x1] crop=1920:800:0:140\n")
+			return err
+		}
+		return nil
+	}}
+	defer func(runner tgexec.Runner) { Runner = runner }(Runner)
+	Runner = recorder
+
+	ctx := context.Background()
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	video, err := NewTranscodedIn(ctx, ws, "./video.mp4", &Profile{AutoCrop: true, Overlay: &Overlay{Text: "kittenbark"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.Width != 1920 || video.Height != 800 || video.Duration != 10 {
+		t.Fatal("unexpected video", video.Width, video.Height, video.Duration)
+	}
+
+	transcoded := false
+	for _, cmd := range recorder.Commands() {
+		if cmd.Name != Ffmpeg || !slices.Contains(cmd.Args, "libx264") {
+			continue
+		}
+		transcoded = true
+		graph := cmd.Args[slices.Index(cmd.Args, "-filter_complex")+1]
+		if !strings.HasPrefix(graph, "[0:v]crop=1920:800:0:140[s1];[s1]drawtext=") {
+			t.Fatal("unexpected filter graph", graph)
+		}
+	}
+	if !transcoded {
+		t.Fatal("no transcoding command", recorder.Commands())
+	}
+}
+
+// TestRunner_Cache isn't parallel: it swaps the package-level Runner and Cache.
+func TestRunner_Cache(t *testing.T) {
+	recorder := &tgexec.Recorder{Respond: func(ctx context.Context, cmd *tgexec.Command) error {
+		if cmd.Name == Ffprobe {
+			_, err := io.WriteString(cmd.Stdout, `{"streams": [{"codec_type": "video", "width": 1280, "height": 720}], "format": {"duration": "3"}}`)
+			return err
+		}
+		return os.WriteFile(cmd.Args[len(cmd.Args)-1], []byte("encoded"), 0644)
+	}}
+	defer func(runner tgexec.Runner, cache *tgcache.Dir) { Runner, Cache = runner, cache }(Runner, Cache)
+	Runner = recorder
+	cache, err := tgcache.Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Cache = cache
+
+	source := filepath.Join(t.TempDir(), "source.webm")
+	if err := os.WriteFile(source, []byte("source"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	transcodes := func(profile *Profile) int {
+		ws, err := tgtemp.New(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		recorder.Reset()
+		video, err := NewTranscodedIn(ctx, ws, source, profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if video.Width != 1280 || video.Height != 720 {
+			t.Fatal("unexpected video", video.Width, video.Height)
+		}
+		total := 0
+		for _, cmd := range recorder.Commands() {
+			if cmd.Name == Ffmpeg && slices.Contains(cmd.Args, "libx264") {
+				total++
+			}
+		}
+		return total
+	}
+
+	if n := transcodes(nil); n != 1 {
+		t.Fatal("expected a transcode, got", n)
+	}
+	if n := transcodes(nil); n != 0 {
+		t.Fatal("expected a cache hit, got transcodes:", n)
+	}
+	if n := transcodes(&Profile{Preset: "veryfast"}); n != 1 {
+		t.Fatal("expected another preset to transcode, got", n)
+	}
+}
@@ -0,0 +1,186 @@
+package tgvideo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Slideshow is a video made of pictures shown one after another, optionally set to music.
+type Slideshow struct {
+	// Images are shown in the given order.
+	Images []string
+	// Duration is how long each image is shown, 3s when zero.
+	Duration time.Duration
+	// Transition is the crossfade between images, zero means hard cuts.
+	Transition time.Duration
+	// KenBurns slowly zooms and pans over every image.
+	KenBurns bool
+	// Audio is played along, it's cut (and faded out) at the end of the video.
+	Audio string
+	// Width and Height of the video, 1280x720 when zero, images are letterboxed to fit.
+	Width, Height int64
+	// Fps is the frame rate, 30 when zero.
+	Fps int64
+}
+
+// SlideshowFromDir makes a slideshow of the pictures in dir (not recursive), ordered by name.
+func SlideshowFromDir(dir string) (*Slideshow, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	slideshow := &Slideshow{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".png", ".jpg", ".jpeg", ".webp":
+			slideshow.Images = append(slideshow.Images, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(slideshow.Images) == 0 {
+		return nil, fmt.Errorf("tgvideo: no pictures in %s", dir)
+	}
+	return slideshow, nil
+}
+
+func SendSlideshow(ctx context.Context, chatId int64, slideshow *Slideshow, opts ...*tg.OptSendVideo) (*tg.Message, error) {
+	ctx = withChat(ctx, chatId)
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	defer ws.Close()
+
+	built, err := ws.Path("*.mp4")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	if err := slideshow.Build(ctx, built); err != nil {
+		return nil, err
+	}
+
+	return send(ctx, ws, chatId, built, "slideshow.mp4", opts...)
+}
+
+// Build renders the slideshow into output, an H264 mp4.
+func (slideshow *Slideshow) Build(ctx context.Context, output string) error {
+	if len(slideshow.Images) == 0 {
+		return errors.New("tgvideo: slideshow has no images")
+	}
+
+	width, height := slideshow.size()
+	fps := slideshow.fps()
+	duration := slideshow.duration().Seconds()
+	transition := min(slideshow.Transition.Seconds(), duration/2)
+
+	// every image but the last lasts transition longer, so that the crossfades eat exactly that.
+	length := func(i int) float64 {
+		if transition > 0 && i != len(slideshow.Images)-1 {
+			return duration + transition
+		}
+		return duration
+	}
+
+	args := []string{"-y"}
+	chains := []string{}
+	for i, image := range slideshow.Images {
+		fit := fmt.Sprintf(
+			"scale=%[1]d:%[2]d:force_original_aspect_ratio=decrease,pad=%[1]d:%[2]d:(ow-iw)/2:(oh-ih)/2:color=black,setsar=1",
+			width, height,
+		)
+		if slideshow.KenBurns {
+			// zoompan makes its frames from a single input one, upscaling first hides the jitter of rounding.
+			args = append(args, "-i", image)
+			frames := int64(length(i) * float64(fps))
+			pan := "iw/2-(iw/zoom/2)"
+			if i%2 == 1 {
+				pan = fmt.Sprintf("(iw-iw/zoom)*on/%d", frames)
+			}
+			chains = append(chains, fmt.Sprintf(
+				"[%d:v]%s,scale=%d:%d,zoompan=z=1+0.15*on/%d:x=%s:y=ih/2-(ih/zoom/2):d=%d:s=%dx%d:fps=%d,format=yuv420p[v%d]",
+				i, fit, width*2, height*2, frames, pan, frames, width, height, fps, i,
+			))
+		} else {
+			args = append(args, "-loop", "1", "-framerate", strconv.FormatInt(fps, 10), "-t", formatFloat(length(i)), "-i", image)
+			chains = append(chains, fmt.Sprintf("[%d:v]%s,fps=%d,format=yuv420p[v%d]", i, fit, fps, i))
+		}
+	}
+
+	last, total := "v0", length(0)
+	for i := 1; i < len(slideshow.Images); i++ {
+		out := fmt.Sprintf("x%d", i)
+		if transition > 0 {
+			chains = append(chains, fmt.Sprintf(
+				"[%s][v%d]xfade=transition=fade:duration=%s:offset=%s[%s]",
+				last, i, formatFloat(transition), formatFloat(total-transition), out,
+			))
+			total += length(i) - transition
+		} else {
+			chains = append(chains, fmt.Sprintf("[%s][v%d]concat=n=2:v=1:a=0[%s]", last, i, out))
+			total += length(i)
+		}
+		last = out
+	}
+
+	maps := []string{"-map", fmt.Sprintf("[%s]", last)}
+	if slideshow.Audio != "" {
+		audio := len(slideshow.Images)
+		args = append(args, "-i", slideshow.Audio)
+		fade := max(total-1, 0)
+		chains = append(chains, fmt.Sprintf(
+			"[%d:a]atrim=end=%s,afade=t=out:st=%s:d=1[a]",
+			audio, formatFloat(total), formatFloat(fade),
+		))
+		maps = append(maps, "-map", "[a]", "-c:a", "aac")
+	}
+
+	args = append(args, "-filter_complex", strings.Join(chains, ";"))
+	args = append(args, maps...)
+	args = append(args,
+		"-c:v", "libx264",
+		"-preset", Preset,
+		"-pix_fmt", "yuv420p",
+		"-r", strconv.FormatInt(fps, 10),
+		"-t", formatFloat(total),
+		"-movflags", "+faststart",
+		output,
+	)
+
+	stdout, stderr, err := run(ctx, nil, Ffmpeg, args...)
+	if err != nil {
+		return fmt.Errorf("failed to build slideshow: %w (stdout: %s, stderr: %s)", err, stdout, stderr)
+	}
+	return nil
+}
+
+func (slideshow *Slideshow) size() (width int64, height int64) {
+	if slideshow.Width <= 0 || slideshow.Height <= 0 {
+		return 1280, 720
+	}
+	return slideshow.Width &^ 1, slideshow.Height &^ 1
+}
+
+func (slideshow *Slideshow) fps() int64 {
+	if slideshow.Fps <= 0 {
+		return 30
+	}
+	return slideshow.Fps
+}
+
+func (slideshow *Slideshow) duration() time.Duration {
+	if slideshow.Duration <= 0 {
+		return 3 * time.Second
+	}
+	return slideshow.Duration
+}
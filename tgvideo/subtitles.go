@@ -0,0 +1,156 @@
+package tgvideo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kittenbark/tg"
+	"github.com/kittenbark/tgmedia/tgsend"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SubtitleMode is what happens to subtitles when a video is transcoded.
+type SubtitleMode int
+
+const (
+	// SubtitlesBurn draws a subtitle track into the picture.
+	SubtitlesBurn SubtitleMode = iota
+	// SubtitlesExtract converts the text subtitle tracks to .srt and sends them as documents replying to the video.
+	SubtitlesExtract
+)
+
+// Subtitles keeps the subtitles of a video, Telegram's player ignores subtitle streams.
+type Subtitles struct {
+	Mode SubtitleMode
+	// Track is the embedded track to burn (see Subtitle.Track).
+	Track int
+	// External is a .srt/.ass file to burn instead of an embedded track. When empty and the video has
+	// no embedded subtitles, a .ass/.srt file next to the video with the same name is used if present.
+	External string
+}
+
+// textSubtitleCodecs are the codecs ffmpeg can convert to srt, bitmap ones (pgs, dvd) it can't.
+var textSubtitleCodecs = map[string]bool{
+	"subrip":   true,
+	"srt":      true,
+	"ass":      true,
+	"ssa":      true,
+	"mov_text": true,
+	"webvtt":   true,
+	"text":     true,
+}
+
+// SendSubtitles extracts the text subtitle tracks of filename and sends them as .srt documents replying to video.
+func SendSubtitles(ctx context.Context, chatId int64, filename string, video *tg.Message, opts ...*tg.OptSendDocument) ([]*tg.Message, error) {
+	ctx = withChat(ctx, chatId)
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	defer ws.Close()
+
+	return sendSubtitles(ctx, ws, chatId, filename, video, opts...)
+}
+
+func sendSubtitles(ctx context.Context, ws *tgtemp.Workspace, chatId int64, filename string, video *tg.Message, opts ...*tg.OptSendDocument) ([]*tg.Message, error) {
+	dir, err := ws.Mkdir("subtitles_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	extracted, err := ExtractSubtitles(ctx, filename, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	opt := &tg.OptSendDocument{}
+	if len(opts) > 0 && opts[0] != nil {
+		copied := *opts[0]
+		opt = &copied
+	}
+	opt.ReplyParameters = &tg.ReplyParameters{MessageId: video.MessageId}
+
+	result := []*tg.Message{}
+	for _, subtitle := range extracted {
+		msg, err := tgsend.SendDocument(ctx, chatId, tg.FromDisk(subtitle), opt)
+		if err != nil {
+			return result, fmt.Errorf("send subtitles %s: %w", subtitle, err)
+		}
+		result = append(result, msg)
+	}
+	return result, nil
+}
+
+// ExtractSubtitles converts every text subtitle track of filename to an .srt file in dir, files are named
+// after the video and the track's language (or number), e.g. movie.eng.srt.
+func ExtractSubtitles(ctx context.Context, filename string, dir string) ([]string, error) {
+	meta, err := getFileMetadata(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file metadata: %w", err)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	result := []string{}
+	used := map[string]bool{}
+	for _, subtitle := range meta.Subtitles {
+		if !textSubtitleCodecs[subtitle.Codec] {
+			continue
+		}
+
+		suffix := subtitle.Language
+		if suffix == "" || used[suffix] {
+			suffix = fmt.Sprintf("%d", subtitle.Track)
+		}
+		used[suffix] = true
+		output := filepath.Join(dir, fmt.Sprintf("%s.%s.srt", base, suffix))
+
+		stdout, stderr, err := run(
+			ctx, nil, Ffmpeg,
+			"-y", "-i", filename,
+			"-map", fmt.Sprintf("0:s:%d", subtitle.Track),
+			"-c:s", "srt",
+			output,
+		)
+		if err != nil {
+			return result, fmt.Errorf("failed to extract subtitles: %w (stdout: %s, stderr: %s)", err, stdout, stderr)
+		}
+		result = append(result, output)
+	}
+	return result, nil
+}
+
+// draw burns the subtitles of filename into the current stream of g, nothing happens in extract mode.
+func (subtitles *Subtitles) draw(ctx context.Context, g *graph, filename string) error {
+	if subtitles.Mode != SubtitlesBurn {
+		return nil
+	}
+
+	if subtitles.External != "" {
+		g.filter("subtitles=filename=" + escapeFilterValue(subtitles.External))
+		return nil
+	}
+
+	meta, err := getFileMetadata(ctx, filename)
+	if err != nil {
+		return fmt.Errorf("failed to get file metadata: %w", err)
+	}
+	if len(meta.Subtitles) > 0 {
+		if subtitles.Track < 0 || subtitles.Track >= len(meta.Subtitles) {
+			return fmt.Errorf("tgvideo: no subtitle track %d (%d total)", subtitles.Track, len(meta.Subtitles))
+		}
+		g.filter(fmt.Sprintf("subtitles=filename=%s:si=%d", escapeFilterValue(filename), subtitles.Track))
+		return nil
+	}
+
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	for _, ext := range []string{".ass", ".srt"} {
+		if _, err := os.Stat(base + ext); err == nil {
+			g.filter("subtitles=filename=" + escapeFilterValue(base+ext))
+			return nil
+		}
+	}
+	return errors.New("tgvideo: no subtitles to burn")
+}
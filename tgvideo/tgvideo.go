@@ -6,11 +6,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/kittenbark/tg"
-	"os"
-	"os/exec"
+	"github.com/kittenbark/tgmedia/tgcache"
+	"github.com/kittenbark/tgmedia/tgexec"
+	"github.com/kittenbark/tgmedia/tgsend"
+	"github.com/kittenbark/tgmedia/tgtemp"
+	"io"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strconv"
-	"sync"
 	"time"
 )
 
@@ -18,196 +22,343 @@ var (
 	Ffprobe = "ffprobe"
 	Ffmpeg  = "ffmpeg"
 	Preset  = "medium"
+	// Runner runs every ffmpeg/ffprobe command of the package, e.g. a tgexec.Recorder in tests.
+	Runner tgexec.Runner = tgexec.Default
+	// Scheduler limits the number of ffmpeg processes running at once, process-wide (ffprobe isn't limited).
+	// A Profile may have its own.
+	Scheduler = tgexec.NewScheduler(runtime.NumCPU())
 )
 
 func Send(ctx context.Context, chatId int64, filename string, opts ...*tg.OptSendVideo) (*tg.Message, error) {
-	return send(ctx, chatId, filename, filename, opts...)
-}
+	ctx = withChat(ctx, chatId)
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	defer ws.Close()
 
-func SendH264(ctx context.Context, chatId int64, filename string, opts ...*tg.OptSendVideo) (*tg.Message, error) {
-	converted, err := os.CreateTemp("", "kittenbark_tgmedia_*.mp4")
+	key, err := tgsend.Key(ctx, filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+		return nil, fmt.Errorf("failed to hash %s: %w", filename, err)
 	}
-	defer time.AfterFunc(time.Second*5, func() {
-		_ = converted.Close()
-		_ = os.Remove(converted.Name())
+	return tgsend.Media(ctx, tgcache.KindVideo, key, sendFileId(ctx, chatId, opts...), func() (*tg.Message, error) {
+		return send(ctx, ws, chatId, filename, filename, opts...)
 	})
-	if err := convertH264(filename, converted); err != nil {
-		return nil, err
+}
+
+func SendH264(ctx context.Context, chatId int64, filename string, opts ...*tg.OptSendVideo) (*tg.Message, error) {
+	return SendTranscoded(ctx, chatId, filename, nil, opts...)
+}
+
+func SendTranscoded(ctx context.Context, chatId int64, filename string, profile *Profile, opts ...*tg.OptSendVideo) (*tg.Message, error) {
+	ctx = withChat(ctx, chatId)
+	ws, err := tgtemp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
 	}
+	defer ws.Close()
 
-	return send(ctx, chatId, converted.Name(), filepath.Base(filename), opts...)
+	msg, _, err := sendTranscoded(ctx, ws, chatId, filename, filepath.Base(filename), profile, opts...)
+	return msg, err
 }
 
-func New(filename string) (video *tg.Video, cleanup func(), err error) {
-	temporaryFiles := []string{}
-	cleanup = func() {
-		wg := &sync.WaitGroup{}
-		for _, file := range temporaryFiles {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				_ = os.Remove(file)
-			}()
+// sendTranscoded returns the video and, when the profile extracts them, the subtitles sent along with it.
+func sendTranscoded(ctx context.Context, ws *tgtemp.Workspace, chatId int64, filename string, name string, profile *Profile, opts ...*tg.OptSendVideo) (*tg.Message, []*tg.Message, error) {
+	key := ""
+	if tgsend.Reuses(ctx) {
+		var err error
+		if key, err = profile.Key(filename); err != nil {
+			return nil, nil, fmt.Errorf("failed to hash %s: %w", filename, err)
 		}
 	}
+	msg, err := tgsend.Media(ctx, tgcache.KindVideo, key, sendFileId(ctx, chatId, opts...), func() (*tg.Message, error) {
+		converted, thumbnail, err := prepare(ctx, ws, filename, profile)
+		if err != nil {
+			return nil, err
+		}
+		return sendWithThumbnail(ctx, chatId, converted, thumbnail, name, opts...)
+	})
+	if err != nil || !profile.extractsSubtitles() {
+		return msg, nil, err
+	}
+	subtitles, err := sendSubtitles(ctx, ws, chatId, filename, msg, optsToDocument(opts))
+	return msg, subtitles, err
+}
 
-	thumbnailFile, err := os.CreateTemp("", "kittenbark_tgmedia_*.jpg")
+// New prepares the video for an album, cleanup removes the thumbnail and must be called after sending.
+func New(filename string) (video *tg.Video, cleanup func(), err error) {
+	ws, err := tgtemp.New(context.Background())
 	if err != nil {
-		return nil, cleanup, fmt.Errorf("failed to create temporary file: %w", err)
+		return nil, func() {}, fmt.Errorf("failed to create workspace: %w", err)
 	}
-	defer func(thumbnailFile *os.File) { _ = thumbnailFile.Close() }(thumbnailFile)
-	temporaryFiles = append(temporaryFiles, thumbnailFile.Name())
+	cleanup = func() { _ = ws.Close() }
 
-	thumbnail, err := buildThumbnail(filename, thumbnailFile)
+	video, err = NewIn(context.Background(), ws, filename)
 	if err != nil {
 		defer cleanup()
-		return nil, cleanup, err
+		return nil, func() {}, err
 	}
+	return video, cleanup, nil
+}
 
-	meta, err := getFileMetadata(filename)
+// NewIn is New keeping its temporary files in ws, they live until ws is closed.
+func NewIn(ctx context.Context, ws *tgtemp.Workspace, filename string) (*tg.Video, error) {
+	thumbnailFile, err := ws.Path("*.jpg")
 	if err != nil {
-		defer cleanup()
-		return nil, cleanup, fmt.Errorf("failed to get file metadata: %w", err)
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	if _, err := buildThumbnail(ctx, filename, thumbnailFile); err != nil {
+		return nil, err
+	}
+	return newVideo(ctx, filename, thumbnailFile)
+}
+
+func newVideo(ctx context.Context, filename string, thumbnail string) (*tg.Video, error) {
+	meta, err := getFileMetadata(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file metadata: %w", err)
 	}
 
 	return &tg.Video{
 		Media:             tg.FromDisk(filename),
-		Thumbnail:         thumbnail,
+		Thumbnail:         tg.FromDisk(thumbnail),
 		Width:             meta.Width,
 		Height:            meta.Height,
 		Duration:          meta.Duration,
 		SupportsStreaming: true,
-	}, cleanup, nil
+	}, nil
 }
 
 func NewH264(filename string) (*tg.Video, func(), error) {
-	converted, err := os.CreateTemp("", "kittenbark_tgmedia_*.mp4")
+	return NewTranscoded(filename, nil)
+}
+
+func NewTranscoded(filename string, profile *Profile) (video *tg.Video, cleanup func(), err error) {
+	ws, err := tgtemp.New(context.Background())
 	if err != nil {
-		return nil, func() {}, fmt.Errorf("failed to create temporary file: %w", err)
+		return nil, func() {}, fmt.Errorf("failed to create workspace: %w", err)
 	}
-	if err := convertH264(filename, converted); err != nil {
-		_ = converted.Close()
-		_ = os.Remove(converted.Name())
+	cleanup = func() { _ = ws.Close() }
+
+	video, err = NewTranscodedIn(context.Background(), ws, filename, profile)
+	if err != nil {
+		defer cleanup()
 		return nil, func() {}, err
 	}
+	return video, cleanup, nil
+}
 
-	video, cleanup, err := New(converted.Name())
-	wrappedCleanup := func() {
-		defer cleanup()
-		_ = converted.Close()
-		_ = os.Remove(converted.Name())
+// NewTranscodedIn is NewTranscoded keeping its temporary files in ws, they live until ws is closed.
+func NewTranscodedIn(ctx context.Context, ws *tgtemp.Workspace, filename string, profile *Profile) (*tg.Video, error) {
+	converted, thumbnail, err := prepare(ctx, ws, filename, profile)
+	if err != nil {
+		return nil, err
 	}
-	return video, wrappedCleanup, nil
+	return newVideo(ctx, converted, thumbnail)
 }
 
-func send(ctx context.Context, chatId int64, filename string, name string, opts ...*tg.OptSendVideo) (*tg.Message, error) {
-	thumbnailFile, err := os.CreateTemp("", "kittenbark_tgmedia_*.jpg")
+func send(ctx context.Context, ws *tgtemp.Workspace, chatId int64, filename string, name string, opts ...*tg.OptSendVideo) (*tg.Message, error) {
+	thumbnailFile, err := ws.Path("*.jpg")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temporary file: %w", err)
 	}
-	defer time.AfterFunc(time.Second, func() {
-		_ = thumbnailFile.Close()
-		_ = os.Remove(thumbnailFile.Name())
-	})
-	thumbnail, err := buildThumbnail(filename, thumbnailFile)
-	if err != nil {
+	if _, err := buildThumbnail(ctx, filename, thumbnailFile); err != nil {
 		return nil, err
 	}
+	return sendWithThumbnail(ctx, chatId, filename, thumbnailFile, name, opts...)
+}
 
-	meta, err := getFileMetadata(filename)
+func sendWithThumbnail(ctx context.Context, chatId int64, filename string, thumbnail string, name string, opts ...*tg.OptSendVideo) (*tg.Message, error) {
+	meta, err := getFileMetadata(ctx, filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get file metadata: %w", err)
 	}
 
 	opts = append(opts, &tg.OptSendVideo{
-		Thumbnail:         thumbnail,
+		Thumbnail:         tg.FromDisk(thumbnail),
 		Width:             meta.Width,
 		Height:            meta.Height,
 		Duration:          meta.Duration,
 		SupportsStreaming: true,
 	})
-	return tg.SendVideo(ctx, chatId, tg.FromDisk(filename, name), opts...)
-}
-
-func convertH264(filename string, converted *os.File) error {
-	convertCmd := exec.Command(
-		Ffmpeg,
-		"-y",
-		"-i", filename,
-		"-c:v", "libx264",
-		"-preset", Preset,
-		"-c:a", "aac",
-		"-strict", "experimental",
-		converted.Name(),
-	)
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	convertCmd.Stdout = &stdout
-	convertCmd.Stderr = &stderr
-	if err := convertCmd.Run(); err != nil {
-		return fmt.Errorf("failed to convert video to H264: %w (stdout: %s, stderr: %s)", err, stdout.String(), stderr.String())
+	return tgsend.SendVideo(ctx, chatId, tg.FromDisk(filename, name), opts...)
+}
+
+// sendFileId sends a video Telegram already has, see tgsend.Media.
+func sendFileId(ctx context.Context, chatId int64, opts ...*tg.OptSendVideo) func(media tg.InputFile) (*tg.Message, error) {
+	return func(media tg.InputFile) (*tg.Message, error) {
+		return tgsend.SendVideo(ctx, chatId, media, opts...)
+	}
+}
+
+func transcode(ctx context.Context, filename string, converted string, profile *Profile) error {
+	args, err := profile.args(ctx, filename, converted)
+	if err != nil {
+		return err
+	}
+	stdout, stderr, err := runScheduled(ctx, profile.scheduler(), nil, Ffmpeg, args...)
+	if err != nil {
+		return fmt.Errorf("failed to convert video to H264: %w (stdout: %s, stderr: %s)", err, stdout, stderr)
 	}
 	return nil
 }
 
-type metadata struct {
+// optsToDocument keeps the options of the video relevant to documents sent along with it.
+func optsToDocument(opts []*tg.OptSendVideo) *tg.OptSendDocument {
+	if len(opts) == 0 || opts[0] == nil {
+		return &tg.OptSendDocument{}
+	}
+	return &tg.OptSendDocument{
+		BusinessConnectionId: opts[0].BusinessConnectionId,
+		MessageThreadId:      opts[0].MessageThreadId,
+		DisableNotification:  opts[0].DisableNotification,
+		ProtectContent:       opts[0].ProtectContent,
+		AllowPaidBroadcast:   opts[0].AllowPaidBroadcast,
+	}
+}
+
+// Metadata is what ffprobe tells about a media file.
+type Metadata struct {
 	Width, Height int64
 	Duration      int64
+	// CreationTime is when the video was recorded (the creation_time tag of the container), zero if unknown.
+	CreationTime time.Time
+	// Subtitles are the subtitle streams in the order ffmpeg numbers them (0:s:N).
+	Subtitles []*Subtitle
+}
+
+// Subtitle is a subtitle stream of a media file.
+type Subtitle struct {
+	// Track is the number among subtitle streams, i.e. N in the 0:s:N stream specifier.
+	Track    int
+	Codec    string
+	Language string
+	Title    string
 }
 
-func getFileMetadata(filename string) (*metadata, error) {
+// Probe returns the metadata of a media file.
+func Probe(ctx context.Context, filename string) (*Metadata, error) {
+	return getFileMetadata(ctx, filename)
+}
+
+func getFileMetadata(ctx context.Context, filename string) (*Metadata, error) {
 	type fileMetadata struct {
 		Streams []struct {
-			Width  int `json:"width"`
-			Height int `json:"height"`
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+			Tags      struct {
+				Language string `json:"language"`
+				Title    string `json:"title"`
+			} `json:"tags"`
 		} `json:"streams"`
 		Format struct {
 			Filename string `json:"filename"`
 			Duration string `json:"duration"`
+			Tags     struct {
+				CreationTime string `json:"creation_time"`
+			} `json:"tags"`
 		} `json:"format"`
 	}
 
-	output, err := exec.Command(Ffprobe, "-v", "error", "-select_streams", "v:0", "-show_entries", "stream=width,height",
-		"-of", "json", "-show_format", filename).Output()
+	output, _, err := run(ctx, nil, Ffprobe, "-v", "error", "-show_entries",
+		"stream=codec_type,codec_name,width,height:stream_tags=language,title",
+		"-of", "json", "-show_format", filename)
 	if err != nil {
-		return nil, fmt.Errorf("%v\n%s", err, string(output))
+		return nil, fmt.Errorf("%v\n%s", err, output)
 	}
 
 	var ffprobeMetadata fileMetadata
-	err = json.Unmarshal(output, &ffprobeMetadata)
+	err = json.Unmarshal([]byte(output), &ffprobeMetadata)
 	if err != nil {
-		return nil, fmt.Errorf("%v\n%s", err, string(output))
+		return nil, fmt.Errorf("%v\n%s", err, output)
 	}
 
-	result := &metadata{}
+	result := &Metadata{}
 	duration, _ := strconv.ParseFloat(ffprobeMetadata.Format.Duration, 64)
 	result.Duration = int64(duration)
-	if len(ffprobeMetadata.Streams) > 0 {
-		result.Width = int64(ffprobeMetadata.Streams[0].Width)
-		result.Height = int64(ffprobeMetadata.Streams[0].Height)
+	result.CreationTime, _ = time.Parse(time.RFC3339Nano, ffprobeMetadata.Format.Tags.CreationTime)
+	videoFound := false
+	for _, stream := range ffprobeMetadata.Streams {
+		switch stream.CodecType {
+		case "video":
+			if videoFound {
+				continue
+			}
+			videoFound = true
+			result.Width = int64(stream.Width)
+			result.Height = int64(stream.Height)
+		case "subtitle":
+			result.Subtitles = append(result.Subtitles, &Subtitle{
+				Track:    len(result.Subtitles),
+				Codec:    stream.CodecName,
+				Language: stream.Tags.Language,
+				Title:    stream.Tags.Title,
+			})
+		}
 	}
 	return result, nil
 }
 
-func buildThumbnail(filename string, thumbnail *os.File) (tg.InputFile, error) {
-	thumbnailCmd := exec.Command(
-		Ffmpeg,
+func buildThumbnail(ctx context.Context, filename string, thumbnail string) (tg.InputFile, error) {
+	stdout, stderr, err := run(
+		ctx, nil, Ffmpeg,
 		"-y", "-i", filename,
 		"-c:v", "mjpeg",
 		"-pix_fmt", "yuvj420p",
 		"-q:v", "2",
 		"-vframes", "1",
 		"-vf", "scale=if(gte(iw\\,ih)\\,min(320\\,iw)\\,-2):if(lt(iw\\,ih)\\,min(320\\,ih)\\,-2)",
-		thumbnail.Name(),
+		thumbnail,
 	)
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	thumbnailCmd.Stdout = &stdout
-	thumbnailCmd.Stderr = &stderr
-	if err := thumbnailCmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to generate thumbnail: %w (stdout: %s, stderr: %s)", err, stdout.String(), stderr.String())
-	}
-	return tg.FromDisk(thumbnail.Name()), nil
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate thumbnail: %w (stdout: %s, stderr: %s)", err, stdout, stderr)
+	}
+	return tg.FromDisk(thumbnail), nil
+}
+
+// run runs a command through Runner and returns what it wrote to stdout and stderr.
+func run(ctx context.Context, stdin io.Reader, name string, args ...string) (stdout string, stderr string, err error) {
+	return runScheduled(ctx, Scheduler, stdin, name, args...)
+}
+
+// runScheduled is run, ffmpeg waits for its turn in scheduler and is limited to the threads of the job.
+func runScheduled(ctx context.Context, scheduler *tgexec.Scheduler, stdin io.Reader, name string, args ...string) (stdout string, stderr string, err error) {
+	if name == Ffmpeg {
+		if job := tgexec.JobFrom(ctx); job != nil && job.Threads > 0 && len(args) > 0 {
+			output := args[len(args)-1]
+			args = append(slices.Clone(args[:len(args)-1]), "-threads", strconv.Itoa(job.Threads), output)
+		}
+		release, err := scheduler.Acquire(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		defer release()
+	}
+
+	var stdoutBuff bytes.Buffer
+	var stderrBuff bytes.Buffer
+	err = Runner.Run(ctx, &tgexec.Command{
+		Name:   name,
+		Args:   args,
+		Stdin:  stdin,
+		Stdout: &stdoutBuff,
+		Stderr: &stderrBuff,
+	})
+	return stdoutBuff.String(), stderrBuff.String(), err
+}
+
+// withChat makes sure ctx carries a job for chatId, so that its ffmpeg processes queue fairly.
+func withChat(ctx context.Context, chatId int64) context.Context {
+	job := tgexec.JobFrom(ctx)
+	if job == nil {
+		return tgexec.WithJob(ctx, &tgexec.Job{Chat: chatId})
+	}
+	if job.Chat == 0 {
+		withChat := *job
+		withChat.Chat = chatId
+		return tgexec.WithJob(ctx, &withChat)
+	}
+	return ctx
 }
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"testing"
+	"time"
 )
 
 var (
@@ -52,3 +53,54 @@ func TestSendNew(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestSendTranscoded(t *testing.T) {
+	t.Parallel()
+
+	for name, overlay := range map[string]*Overlay{
+		"text":  {Text: "kittenbark: 'tgmedia'", Position: TopLeft, Margin: 0.03, Opacity: 0.7},
+		"image": {Image: "./watermark.png", Position: BottomRight, Margin: 0.02, Opacity: 0.5, Scale: 0.25},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := SendTranscoded(bot.Context(), chat, "./video.mp4", &Profile{Overlay: overlay}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestSendTranscoded_Subtitles(t *testing.T) {
+	t.Parallel()
+
+	t.Run("burn", func(t *testing.T) {
+		t.Parallel()
+		profile := &Profile{Subtitles: &Subtitles{Mode: SubtitlesBurn}}
+		if _, err := SendTranscoded(bot.Context(), chat, "./subtitles.mkv", profile); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("extract", func(t *testing.T) {
+		t.Parallel()
+		profile := &Profile{Subtitles: &Subtitles{Mode: SubtitlesExtract}}
+		if _, err := SendTranscoded(bot.Context(), chat, "./subtitles.mkv", profile); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestSendSlideshow(t *testing.T) {
+	t.Parallel()
+
+	slideshow, err := SlideshowFromDir("./pictures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slideshow.Transition = time.Second / 2
+	slideshow.KenBurns = true
+	slideshow.Audio = "./audio.mp3"
+	if _, err := SendSlideshow(bot.Context(), chat, slideshow); err != nil {
+		t.Fatal(err)
+	}
+}